@@ -0,0 +1,235 @@
+package multiindex
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	// ErrNotFound is reported when applying a change to an absent element
+	ErrNotFound = errors.New("element not found")
+
+	errCorruptChange = errors.New("multiindex: corrupt change record")
+)
+
+type Op uint8
+
+const (
+	OpInsert Op = iota + 1
+	OpErase
+	OpModify
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpErase:
+		return "erase"
+	case OpModify:
+		return "modify"
+	}
+	return "unknown"
+}
+
+// Change describes a successful mutation of a MultiIndex
+type Change[V comparable] struct {
+	Op  Op
+	Old V // the erased or replaced element
+	New V // the inserted or replacing element
+}
+
+// Inverse returns the change reverting `c`
+func (c Change[V]) Inverse() Change[V] {
+	switch c.Op {
+	case OpInsert:
+		return Change[V]{Op: OpErase, Old: c.New}
+	case OpErase:
+		return Change[V]{Op: OpInsert, New: c.Old}
+	}
+	return Change[V]{Op: c.Op, Old: c.New, New: c.Old}
+}
+
+type observer[V comparable] struct {
+	f func(c Change[V])
+}
+
+// Observe calls `f` after every change of the MultiIndex, evictions and expirations included.
+// The returned function unregisters `f`.
+func (m *MultiIndex[V]) Observe(f func(c Change[V])) (cancel func()) {
+	o := &observer[V]{f}
+	m.observers = append(m.observers, o)
+	return func() {
+		// copied: notify may be ranging over the current slice
+		m.observers = slices.DeleteFunc(slices.Clone(m.observers), func(x *observer[V]) bool { return x == o })
+	}
+}
+
+func (m *MultiIndex[V]) notify(c Change[V]) {
+	if m.versions != nil {
+		m.trackVersion(c)
+	}
+	for _, o := range m.observers {
+		o.f(c)
+	}
+}
+
+type guard[V comparable] struct {
+	check func(c Change[V]) error
+	apply func(c Change[V]) (undo func(), err error)
+}
+
+// addGuard calls `check` before every erasure and modification; an error cancels it.
+// Once the checks of all guards passed, `apply` (may be nil) performs side effects, such as
+// cascading to other MultiIndexes, and returns how to undo them.
+func (m *MultiIndex[V]) addGuard(check func(c Change[V]) error, apply func(c Change[V]) (undo func(), err error)) (cancel func()) {
+	g := &guard[V]{check, apply}
+	m.guards = append(m.guards, g)
+	return func() {
+		m.guards = slices.DeleteFunc(slices.Clone(m.guards), func(x *guard[V]) bool { return x == g })
+	}
+}
+
+// checkGuards runs the checks of all guards, without side effects
+func (m *MultiIndex[V]) checkGuards(c Change[V]) error {
+	for _, g := range m.guards {
+		if err := g.check(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guard runs the checks of all guards, then their actions; if an action fails, the previous ones are undone.
+// It returns a function undoing all actions.
+func (m *MultiIndex[V]) guard(c Change[V]) (undo func(), err error) {
+	if err := m.checkGuards(c); err != nil {
+		return nil, err
+	}
+	var undos []func()
+	undo = func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+	for _, g := range m.guards {
+		if g.apply == nil {
+			continue
+		}
+		u, err := g.apply(c)
+		if err != nil {
+			undo()
+			return nil, err
+		}
+		if u != nil {
+			undos = append(undos, u)
+		}
+	}
+	return undo, nil
+}
+
+// Apply performs a change reported by Observe, e.g. to replay it on another MultiIndex.
+// Unlike Insert and Modify, it never evicts.
+func (m *MultiIndex[V]) Apply(c Change[V]) error {
+	switch c.Op {
+	case OpInsert:
+		if err := m.insert(c.New); err != nil {
+			return err
+		}
+	case OpErase:
+		if _, err := m.eraseGuarded(c.Old); err != nil {
+			return err
+		}
+	case OpModify:
+		if err := m.modify(c.Old, c.New); err != nil {
+			return err
+		}
+	default:
+		return errors.New("multiindex: unknown change")
+	}
+	m.notify(c)
+	return nil
+}
+
+// restore performs a change read back from a log, without guards or constraints: they held
+// when the change was made, while related MultiIndexes (see NewForeignKey) may not be restored yet
+func (m *MultiIndex[V]) restore(c Change[V]) error {
+	switch c.Op {
+	case OpInsert:
+		if err := m.insertChecked(c.New, false); err != nil {
+			return err
+		}
+	case OpErase:
+		if !m.Contains(c.Old) {
+			return ErrNotFound
+		}
+		m.erase(c.Old)
+	case OpModify:
+		if !m.Contains(c.Old) {
+			return ErrNotFound
+		}
+		m.erase(c.Old)
+		if err := m.insertChecked(c.New, false); err != nil {
+			if m.insertChecked(c.Old, false) != nil {
+				panic("multiindex: failed to restore element after rejected Modify")
+			}
+			return err
+		}
+	default:
+		return errors.New("multiindex: unknown change")
+	}
+	m.notify(c)
+	return nil
+}
+
+// encodeChange serializes `c` as an op byte followed by the element,
+// or by uvarint length | old | new for a modification
+func encodeChange[V comparable](codec Codec[V], c Change[V]) ([]byte, error) {
+	payload := []byte{byte(c.Op)}
+	switch c.Op {
+	case OpInsert:
+		data, err := codec.Encode(c.New)
+		return append(payload, data...), err
+	case OpErase:
+		data, err := codec.Encode(c.Old)
+		return append(payload, data...), err
+	}
+	old, err := codec.Encode(c.Old)
+	if err != nil {
+		return nil, err
+	}
+	new, err := codec.Encode(c.New)
+	if err != nil {
+		return nil, err
+	}
+	payload = binary.AppendUvarint(payload, uint64(len(old)))
+	return append(append(payload, old...), new...), nil
+}
+
+func decodeChange[V comparable](codec Codec[V], payload []byte) (c Change[V], err error) {
+	if len(payload) == 0 {
+		return c, errCorruptChange
+	}
+	c.Op = Op(payload[0])
+	data := payload[1:]
+	switch c.Op {
+	case OpInsert:
+		c.New, err = codec.Decode(data)
+	case OpErase:
+		c.Old, err = codec.Decode(data)
+	case OpModify:
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return c, errCorruptChange
+		}
+		if c.Old, err = codec.Decode(data[n : n+int(size)]); err != nil {
+			return
+		}
+		c.New, err = codec.Decode(data[n+int(size):])
+	default:
+		err = fmt.Errorf("%w: unknown op %d", errCorruptChange, c.Op)
+	}
+	return
+}
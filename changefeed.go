@@ -0,0 +1,275 @@
+package multiindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ErrGap is reported by Applier when a record is missing
+var ErrGap = errors.New("multiindex: changefeed records are missing")
+
+type RecordKind uint8
+
+const (
+	RecordChange RecordKind = iota + 1 // Change is the change number Seq
+	RecordReset                        // a dump of the state after change Seq follows; the follower must clear its state
+	RecordDump                         // Change.New is an element of the dump
+)
+
+// Record is an entry of a Changefeed
+type Record[V comparable] struct {
+	Seq    uint64
+	Kind   RecordKind
+	Change Change[V]
+}
+
+// Sink receives the records of a Changefeed
+type Sink[V comparable] interface {
+	Send(r Record[V]) error
+}
+
+type chanSink[V comparable] chan<- Record[V]
+
+func (s chanSink[V]) Send(r Record[V]) error {
+	s <- r
+	return nil
+}
+
+// ChanSink sends records to `ch`; sending blocks changes of the MultiIndex until `ch` has room
+func ChanSink[V comparable](ch chan<- Record[V]) Sink[V] {
+	return chanSink[V](ch)
+}
+
+type writerSink[V comparable] struct {
+	w     io.Writer
+	codec Codec[V]
+}
+
+// WriterSink writes records to `w` for Applier.Consume:
+//
+//	uvarint length | kind byte | uvarint seq | change (see Durable), none for RecordReset
+func WriterSink[V comparable](w io.Writer, codec Codec[V]) Sink[V] {
+	return writerSink[V]{w, codec}
+}
+
+func (s writerSink[V]) Send(r Record[V]) error {
+	payload := binary.AppendUvarint([]byte{byte(r.Kind)}, r.Seq)
+	if r.Kind != RecordReset {
+		change, err := encodeChange(s.codec, r.Change)
+		if err != nil {
+			return err
+		}
+		payload = append(payload, change...)
+	}
+	_, err := s.w.Write(append(binary.AppendUvarint(nil, uint64(len(payload))), payload...))
+	return err
+}
+
+// Changefeed numbers the changes of a MultiIndex and sends them to followers.
+// It must be used under the lock guarding the MultiIndex, if any.
+type Changefeed[V comparable] struct {
+	m       *MultiIndex[V]
+	seq     uint64
+	backlog []Record[V] // ring of the last changes, to resume followers
+	oldest  int         // position of the oldest change in a full backlog
+	retain  int
+	subs    []*Subscription[V]
+	cancel  func()
+}
+
+// Subscription is a follower of a Changefeed
+type Subscription[V comparable] struct {
+	f    *Changefeed[V]
+	sink Sink[V]
+	err  error
+}
+
+// NewChangefeed starts numbering changes of `m`; the last `retain` changes are kept
+// so that followers can resume without a new dump
+func NewChangefeed[V comparable](m *MultiIndex[V], retain int) *Changefeed[V] {
+	f := &Changefeed[V]{m: m, retain: retain}
+	f.cancel = m.Observe(f.record)
+	return f
+}
+
+// Seq returns the number of the last change
+func (f *Changefeed[V]) Seq() uint64 {
+	return f.seq
+}
+
+func (f *Changefeed[V]) record(c Change[V]) {
+	f.seq++
+	r := Record[V]{Seq: f.seq, Kind: RecordChange, Change: c}
+	if len(f.backlog) < f.retain {
+		f.backlog = append(f.backlog, r)
+	} else if f.retain > 0 {
+		f.backlog[f.oldest] = r
+		f.oldest = (f.oldest + 1) % f.retain
+	}
+	for _, s := range f.subs {
+		s.send(r)
+	}
+}
+
+// Follow sends to `sink` the changes after number `from`, then every new change.
+// If they are no longer retained (or `from` is 0 for a new follower), a dump of the current
+// state is sent instead.
+func (f *Changefeed[V]) Follow(from uint64, sink Sink[V]) *Subscription[V] {
+	s := &Subscription[V]{f: f, sink: sink}
+	resumable := from != 0 && from <= f.seq &&
+		(from == f.seq || len(f.backlog) > 0 && f.backlog[f.oldest].Seq <= from+1)
+	if resumable {
+		for i := range f.backlog {
+			if r := f.backlog[(f.oldest+i)%len(f.backlog)]; r.Seq > from {
+				s.send(r)
+			}
+		}
+	} else {
+		s.send(Record[V]{Seq: f.seq, Kind: RecordReset})
+		f.m.MultiIndexBy[f.m.primary()].TraversalValue(func(v V) bool {
+			s.send(Record[V]{Seq: f.seq, Kind: RecordDump, Change: Change[V]{Op: OpInsert, New: v}})
+			return s.err == nil
+		})
+	}
+	if s.err == nil {
+		f.subs = append(f.subs, s)
+	}
+	return s
+}
+
+// Close stops the feed and all its subscriptions
+func (f *Changefeed[V]) Close() {
+	f.cancel()
+	f.subs = nil
+}
+
+func (s *Subscription[V]) send(r Record[V]) {
+	if s.err != nil {
+		return
+	}
+	if s.err = s.sink.Send(r); s.err != nil {
+		s.Stop()
+	}
+}
+
+// Stop unsubscribes
+func (s *Subscription[V]) Stop() {
+	// copied: record may be ranging over the current slice
+	s.f.subs = slices.DeleteFunc(slices.Clone(s.f.subs), func(x *Subscription[V]) bool { return x == s })
+}
+
+// Err returns the error of the sink which ended the subscription
+func (s *Subscription[V]) Err() error {
+	return s.err
+}
+
+// Applier replays the records of a Changefeed on a follower MultiIndex
+type Applier[V comparable] struct {
+	m   *MultiIndex[V]
+	seq uint64
+}
+
+// NewApplier follows into `m`, which is cleared by the first dump; `seq` is the number
+// of the last change already in `m`, 0 for a new follower
+func NewApplier[V comparable](m *MultiIndex[V], seq uint64) *Applier[V] {
+	return &Applier[V]{m: m, seq: seq}
+}
+
+// Seq returns the number of the last applied change, to resume with Changefeed.Follow
+func (a *Applier[V]) Seq() uint64 {
+	return a.seq
+}
+
+// Apply applies `r`; records already applied are ignored, missing ones are reported as ErrGap
+func (a *Applier[V]) Apply(r Record[V]) error {
+	switch r.Kind {
+	case RecordReset:
+		var all []V
+		a.m.MultiIndexBy[a.m.primary()].TraversalValue(func(v V) bool {
+			all = append(all, v)
+			return true
+		})
+		for _, v := range all {
+			err := a.m.Apply(Change[V]{Op: OpErase, Old: v})
+			// an element may already be gone with a cascade; any other error leaves stale elements
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("multiindex: clearing the follower for the dump after %d: %w", r.Seq, err)
+			}
+		}
+	case RecordDump:
+		if r.Seq != a.seq {
+			return ErrGap
+		}
+		if err := a.m.Apply(r.Change); err != nil {
+			return err
+		}
+	case RecordChange:
+		if r.Seq <= a.seq {
+			// already applied
+			return nil
+		}
+		if r.Seq != a.seq+1 {
+			return fmt.Errorf("%w: got %d after %d", ErrGap, r.Seq, a.seq)
+		}
+		if err := a.m.Apply(r.Change); err != nil {
+			return fmt.Errorf("multiindex: applying change %d: %w", r.Seq, err)
+		}
+	default:
+		return fmt.Errorf("multiindex: unknown record kind %d", r.Kind)
+	}
+	a.seq = r.Seq
+	return nil
+}
+
+// Consume applies the records written by WriterSink until `r` ends
+func (a *Applier[V]) Consume(r io.Reader, codec Codec[V]) error {
+	br := bufio.NewReader(r)
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if int64(size) < 0 {
+			return errCorruptChange
+		}
+		// a corrupt length must not allocate more than what is actually read
+		var payload bytes.Buffer
+		if _, err := io.CopyN(&payload, br, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		rec, err := decodeRecord(codec, payload.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := a.Apply(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func decodeRecord[V comparable](codec Codec[V], payload []byte) (r Record[V], err error) {
+	if len(payload) == 0 {
+		return r, errCorruptChange
+	}
+	r.Kind = RecordKind(payload[0])
+	seq, n := binary.Uvarint(payload[1:])
+	if n <= 0 {
+		return r, errCorruptChange
+	}
+	r.Seq = seq
+	if r.Kind != RecordReset {
+		r.Change, err = decodeChange(codec, payload[1+n:])
+	}
+	return
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+type genIndex struct {
+	Field   string
+	KeyType string
+	Unique  bool
+	Ordered bool
+	Cmp     string // comparator expression of ordered indexes
+}
+
+type genData struct {
+	Package    string
+	Type       string
+	StdImports []string
+	Imports    []string
+	Indexes    []genIndex
+}
+
+// Generate parses the package in `dir` and returns the source of <typeName>Index
+func Generate(dir, typeName string, specs []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		pkgName string
+		st      *ast.StructType
+		file    *ast.File
+	)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		pkgName = f.Name.Name
+		ast.Inspect(f, func(n ast.Node) bool {
+			ts, ok := n.(*ast.TypeSpec)
+			if !ok || ts.Name.Name != typeName {
+				return true
+			}
+			if s, ok := ts.Type.(*ast.StructType); ok {
+				st, file = s, f
+			}
+			return false
+		})
+	}
+	if st == nil {
+		return nil, fmt.Errorf("struct type %s not found in %s", typeName, dir)
+	}
+
+	fields := make(map[string]ast.Expr)
+	for _, f := range st.Fields.List {
+		for _, name := range f.Names {
+			fields[name.Name] = f.Type
+		}
+	}
+
+	data := genData{Package: pkgName, Type: typeName}
+	imports := map[string]bool{"iter": true}
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		idx := genIndex{Field: parts[0]}
+		expr, ok := fields[idx.Field]
+		if !ok {
+			return nil, fmt.Errorf("index %q: %s has no field %s", spec, typeName, idx.Field)
+		}
+		if seen[idx.Field] {
+			return nil, fmt.Errorf("index %q: field %s is indexed twice", spec, idx.Field)
+		}
+		seen[idx.Field] = true
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "unique":
+				idx.Unique = true
+			case "nonunique":
+				idx.Unique = false
+			case "ordered":
+				idx.Ordered = true
+			case "hashed":
+				idx.Ordered = false
+			default:
+				return nil, fmt.Errorf("index %q: unknown option %q", spec, opt)
+			}
+		}
+
+		idx.KeyType = types.ExprString(expr)
+		if idx.KeyType == "time.Time" && !idx.Ordered {
+			// == on time.Time also compares the location and the monotonic reading
+			return nil, fmt.Errorf("index %q: time.Time keys must be ordered, == does not compare instants", spec)
+		}
+		if sel, ok := expr.(*ast.SelectorExpr); ok {
+			pkgPath, err := importPath(file, sel)
+			if err != nil {
+				return nil, fmt.Errorf("index %q: %w", spec, err)
+			}
+			imports[pkgPath] = true
+		}
+		if idx.Ordered {
+			imports["github.com/agmt/go-multiindex/gostl_rbtree"] = true
+			if idx.KeyType == "time.Time" {
+				idx.Cmp = "func(a, b time.Time) int { return a.Compare(b) }"
+			} else {
+				imports["cmp"] = true
+				idx.Cmp = "cmp.Compare[" + idx.KeyType + "]"
+			}
+		}
+		data.Indexes = append(data.Indexes, idx)
+	}
+	for imp := range imports {
+		if strings.Contains(strings.Split(imp, "/")[0], ".") {
+			data.Imports = append(data.Imports, imp)
+		} else {
+			data.StdImports = append(data.StdImports, imp)
+		}
+	}
+	sort.Strings(data.StdImports)
+	sort.Strings(data.Imports)
+
+	var buf bytes.Buffer
+	if err := genTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not parse: %w\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+func importPath(file *ast.File, sel *ast.SelectorExpr) (string, error) {
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return "", fmt.Errorf("unsupported key type %s", types.ExprString(sel))
+	}
+	for _, imp := range file.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return "", err
+		}
+		name := path.Base(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == pkg.Name {
+			if imp.Name != nil && imp.Name.Name != path.Base(p) {
+				return "", fmt.Errorf("renamed import %s is not supported", imp.Name.Name)
+			}
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("import of %s not found", pkg.Name)
+}
+
+var genTemplate = template.Must(template.New("gen").Parse(`// Code generated by multiindex-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .StdImports}}
+	"{{.}}"
+{{- end}}
+{{if .Imports}}
+{{- range .Imports}}
+	{{if eq . "github.com/agmt/go-multiindex/gostl_rbtree"}}rbtree {{end}}"{{.}}"
+{{- end}}
+{{- end}}
+)
+
+{{$t := .Type}}
+// {{$t}}Index indexes {{$t}} by{{range $i, $x := .Indexes}}{{if $i}},{{end}} {{$x.Field}}{{end}}
+type {{$t}}Index struct {
+	size int
+{{- range .Indexes}}
+{{- if .Ordered}}
+	by{{.Field}} *rbtree.RbTree[{{.KeyType}}, {{$t}}]
+{{- else if .Unique}}
+	by{{.Field}} map[{{.KeyType}}]{{$t}}
+{{- else}}
+	by{{.Field}} map[{{.KeyType}}]map[{{$t}}]struct{}
+{{- end}}
+{{- end}}
+}
+
+func New{{$t}}Index() *{{$t}}Index {
+	return &{{$t}}Index{
+{{- range .Indexes}}
+{{- if .Ordered}}
+		by{{.Field}}: rbtree.New[{{.KeyType}}, {{$t}}]({{.Cmp}}),
+{{- else if .Unique}}
+		by{{.Field}}: make(map[{{.KeyType}}]{{$t}}),
+{{- else}}
+		by{{.Field}}: make(map[{{.KeyType}}]map[{{$t}}]struct{}),
+{{- end}}
+{{- end}}
+	}
+}
+
+func (x *{{$t}}Index) Len() int {
+	return x.size
+}
+
+// Insert adds v to all indexes; it fails if v is already present or breaks a unique index
+func (x *{{$t}}Index) Insert(v {{$t}}) bool {
+	if x.Contains(v) {
+		return false
+	}
+{{- range .Indexes}}
+{{- if .Unique}}
+{{- if .Ordered}}
+	if x.by{{.Field}}.FindNode(v.{{.Field}}) != nil {
+		return false
+	}
+{{- else}}
+	if _, ok := x.by{{.Field}}[v.{{.Field}}]; ok {
+		return false
+	}
+{{- end}}
+{{- end}}
+{{- end}}
+
+{{- range .Indexes}}
+{{- if .Ordered}}
+	x.by{{.Field}}.Insert(v.{{.Field}}, v)
+{{- else if .Unique}}
+	x.by{{.Field}}[v.{{.Field}}] = v
+{{- else}}
+	if x.by{{.Field}}[v.{{.Field}}] == nil {
+		x.by{{.Field}}[v.{{.Field}}] = make(map[{{$t}}]struct{})
+	}
+	x.by{{.Field}}[v.{{.Field}}][v] = struct{}{}
+{{- end}}
+{{- end}}
+	x.size++
+	return true
+}
+
+// Erase removes v from all indexes
+func (x *{{$t}}Index) Erase(v {{$t}}) bool {
+	if !x.Contains(v) {
+		return false
+	}
+{{- range .Indexes}}
+{{- if .Ordered}}
+	for node := x.by{{.Field}}.FindLowerBoundNode(v.{{.Field}}); node != nil; node = node.Next() {
+		if node.Value() == v {
+			x.by{{.Field}}.Delete(node)
+			break
+		}
+	}
+{{- else if .Unique}}
+	delete(x.by{{.Field}}, v.{{.Field}})
+{{- else}}
+	delete(x.by{{.Field}}[v.{{.Field}}], v)
+	if len(x.by{{.Field}}[v.{{.Field}}]) == 0 {
+		delete(x.by{{.Field}}, v.{{.Field}})
+	}
+{{- end}}
+{{- end}}
+	x.size--
+	return true
+}
+
+{{with index .Indexes 0}}
+func (x *{{$t}}Index) Contains(v {{$t}}) bool {
+{{- if .Ordered}}
+	for node := x.by{{.Field}}.FindLowerBoundNode(v.{{.Field}}); node != nil && ({{.Cmp}})(node.Key(), v.{{.Field}}) == 0; node = node.Next() {
+		if node.Value() == v {
+			return true
+		}
+	}
+	return false
+{{- else if .Unique}}
+	stored, ok := x.by{{.Field}}[v.{{.Field}}]
+	return ok && stored == v
+{{- else}}
+	_, ok := x.by{{.Field}}[v.{{.Field}}][v]
+	return ok
+{{- end}}
+}
+
+// All yields every element{{if .Ordered}} in {{.Field}} order{{else}} in no particular order{{end}}
+func (x *{{$t}}Index) All() iter.Seq[{{$t}}] {
+	return func(yield func({{$t}}) bool) {
+{{- if .Ordered}}
+		for node := x.by{{.Field}}.First(); node != nil; node = node.Next() {
+			if !yield(node.Value()) {
+				return
+			}
+		}
+{{- else if .Unique}}
+		for _, v := range x.by{{.Field}} {
+			if !yield(v) {
+				return
+			}
+		}
+{{- else}}
+		for _, set := range x.by{{.Field}} {
+			for v := range set {
+				if !yield(v) {
+					return
+				}
+			}
+		}
+{{- end}}
+	}
+}
+{{end}}
+
+{{- range .Indexes}}
+{{if .Unique}}
+func (x *{{$t}}Index) FindBy{{.Field}}(k {{.KeyType}}) (v {{$t}}, ok bool) {
+{{- if .Ordered}}
+	node := x.by{{.Field}}.FindNode(k)
+	if node == nil {
+		return
+	}
+	return node.Value(), true
+{{- else}}
+	v, ok = x.by{{.Field}}[k]
+	return
+{{- end}}
+}
+{{else}}
+func (x *{{$t}}Index) Where{{.Field}}(k {{.KeyType}}) iter.Seq[{{$t}}] {
+	return func(yield func({{$t}}) bool) {
+{{- if .Ordered}}
+		for node := x.by{{.Field}}.FindNode(k); node != nil; node = node.Next() {
+			if ({{.Cmp}})(node.Key(), k) != 0 || !yield(node.Value()) {
+				return
+			}
+		}
+{{- else}}
+		for v := range x.by{{.Field}}[k] {
+			if !yield(v) {
+				return
+			}
+		}
+{{- end}}
+	}
+}
+{{end}}
+{{- if .Ordered}}
+// Range{{.Field}} yields elements with lo <= {{.Field}} < hi in ascending order
+func (x *{{$t}}Index) Range{{.Field}}(lo, hi {{.KeyType}}) iter.Seq[{{$t}}] {
+	return func(yield func({{$t}}) bool) {
+		for node := x.by{{.Field}}.FindLowerBoundNode(lo); node != nil; node = node.Next() {
+			if ({{.Cmp}})(node.Key(), hi) >= 0 || !yield(node.Value()) {
+				return
+			}
+		}
+	}
+}
+{{end}}
+{{- end}}
+`))
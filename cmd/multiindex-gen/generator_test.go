@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const generatedMain = `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func main() {
+	x := NewBookIndex()
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	x.Insert(Book{Name: "A", Author: "X", ISBN: "1", PublishedAt: t0, Pages: 100})
+	x.Insert(Book{Name: "B", Author: "X", ISBN: "2", PublishedAt: t0.AddDate(1, 0, 0), Pages: 200})
+	x.Insert(Book{Name: "C", Author: "Y", ISBN: "3", PublishedAt: t0.AddDate(2, 0, 0), Pages: 300})
+	dup := x.Insert(Book{Name: "D", Author: "Y", ISBN: "3", Pages: 400})
+
+	b, ok := x.FindByISBN("2")
+	byAuthor := 0
+	for range x.WhereAuthor("X") {
+		byAuthor++
+	}
+	var names []string
+	for b := range x.RangePublishedAt(t0, t0.AddDate(2, 0, 0)) {
+		names = append(names, b.Name)
+	}
+	x.Erase(b)
+	_, found := x.FindByPages(200)
+	fmt.Println(dup, b.Name, ok, byAuthor, names, x.Len(), found)
+}
+`
+
+func TestGenerate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a module")
+	}
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := Generate("testdata", "Book", []string{"ISBN:unique", "Author", "PublishedAt:ordered", "Pages:ordered:unique"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	model, err := os.ReadFile("testdata/book.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gosum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod": "module books\n\ngo 1.23\n\nrequire github.com/agmt/go-multiindex v0.0.0\n\n" +
+			"replace github.com/agmt/go-multiindex => " + root + "\n",
+		"go.sum":             string(gosum),
+		"book.go":            strings.Replace(string(model), "package books", "package main", 1),
+		"book_multiindex.go": strings.Replace(string(src), "package books", "package main", 1),
+		"main.go":            generatedMain,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command("go", "run", "-mod=mod", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "false B true 2 [A B] 2 false" {
+		t.Errorf("output: %s", got)
+	}
+}
+
+func TestGenerateHashedTime(t *testing.T) {
+	_, err := Generate("testdata", "Book", []string{"PublishedAt:hashed"})
+	if err == nil || !strings.Contains(err.Error(), "must be ordered") {
+		t.Errorf("hashed time.Time: %v", err)
+	}
+	if _, err := Generate("testdata", "Book", []string{"PublishedAt"}); err == nil {
+		t.Errorf("time.Time is hashed by default and must be rejected")
+	}
+}
@@ -0,0 +1,11 @@
+package books
+
+import "time"
+
+type Book struct {
+	Name        string
+	Author      string
+	ISBN        string
+	PublishedAt time.Time
+	Pages       int
+}
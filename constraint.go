@@ -0,0 +1,119 @@
+package multiindex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConstraintError reports an element violating a constraint (see AddCheck and AddMaxPerKey)
+type ConstraintError struct {
+	Constraint string
+	Msg        string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("multiindex: constraint %s violated: %s", e.Constraint, e.Msg)
+}
+
+// KeyCounter is implemented by non-unique indexes, see AddMaxPerKey
+type KeyCounter[V comparable] interface {
+	// CountKey returns the number of elements with the key of `v`
+	CountKey(v V) int
+}
+
+type constraint[V comparable] struct {
+	name    string
+	check   func(v V) bool
+	counter KeyCounter[V]
+	index   string
+	max     int
+}
+
+// violation returns the error if `v` violates `c`; `v` is already indexed for per-key limits
+func (c constraint[V]) violation(v V) error {
+	if c.check != nil {
+		if !c.check(v) {
+			return &ConstraintError{c.name, fmt.Sprintf("check failed for %v", v)}
+		}
+		return nil
+	}
+	if n := c.counter.CountKey(v); n > c.max {
+		return &ConstraintError{c.name, fmt.Sprintf("%d elements with the same key in index %s, at most %d allowed", n, c.index, c.max)}
+	}
+	return nil
+}
+
+// AddCheck rejects elements for which `check` returns false, e.g.
+//
+//	m.AddCheck("positive price", func(b Book) bool { return b.Price > 0 })
+//
+// Insert, Modify and Apply then fail with *ConstraintError. It fails if an element already present violates it.
+func (m *MultiIndex[V]) AddCheck(name string, check func(v V) bool) error {
+	return m.addConstraint(constraint[V]{name: name, check: check})
+}
+
+// AddMaxPerKey rejects elements whose key in `idx`, one of the indexes of the MultiIndex, is shared
+// by more than `max` elements, e.g. at most 5 books per author.
+// It fails if the limit is already exceeded.
+func (m *MultiIndex[V]) AddMaxPerKey(name string, idx MultiIndexByI[V], max int) error {
+	counter, ok := idx.(KeyCounter[V])
+	if !ok {
+		return errors.New("multiindex: AddMaxPerKey needs an index counting keys")
+	}
+	pos := -1
+	for i, cont := range m.MultiIndexBy {
+		if cont == idx {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return errors.New("multiindex: AddMaxPerKey needs an index of the multiindex")
+	}
+	return m.addConstraint(constraint[V]{name: name, counter: counter, index: m.IndexName(pos), max: max})
+}
+
+func (m *MultiIndex[V]) addConstraint(c constraint[V]) error {
+	if c.name == "" {
+		return errors.New("multiindex: empty constraint name")
+	}
+	for _, other := range m.constraints {
+		if other.name == c.name {
+			return fmt.Errorf("multiindex: constraint %s already exists", c.name)
+		}
+	}
+	if len(m.MultiIndexBy) > 0 {
+		var err error
+		m.MultiIndexBy[m.primary()].TraversalValue(func(v V) bool {
+			err = c.violation(v)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	m.constraints = append(m.constraints, c)
+	return nil
+}
+
+// RemoveConstraint removes the constraint registered as `name`
+func (m *MultiIndex[V]) RemoveConstraint(name string) {
+	for i, c := range m.constraints {
+		if c.name == name {
+			m.constraints = append(m.constraints[:i:i], m.constraints[i+1:]...)
+			return
+		}
+	}
+}
+
+// checkConstraints returns the first violation by `v`; per-key limits are checked
+// only if `indexed` is set, after `v` is added to the indexes
+func (m *MultiIndex[V]) checkConstraints(v V, indexed bool) error {
+	for _, c := range m.constraints {
+		if (c.check == nil) == indexed {
+			if err := c.violation(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,462 @@
+package multiindex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SyncPolicy int
+
+const (
+	SyncAlways SyncPolicy = iota // fsync after every operation
+	SyncBatch                    // fsync every DurableOptions.BatchInterval
+	SyncNone                     // fsync only on Sync, Compact and Close
+)
+
+type DurableOptions struct {
+	Sync          SyncPolicy
+	BatchInterval time.Duration // 100ms by default
+	SegmentSize   int64         // a new log segment is started past this size, 64 MiB by default
+}
+
+// ErrCorruptLog is reported when a log segment other than the last one is damaged
+var ErrCorruptLog = errors.New("multiindex: corrupt log")
+
+// Durable logs the changes of a MultiIndex to a directory, see OpenDurable.
+//
+// The directory holds snapshot-<N>.snap, the state before log segment N, and the segments
+// wal-<N>.log, wal-<N+1>.log, ... Every record is
+//
+//	uvarint length | op byte | element(s) | CRC-32 (IEEE) of op and elements
+//
+// where a modification stores uvarint length | old | new.
+// Durable is not safe for concurrent use, as MultiIndex itself.
+//
+// After a write error every operation fails with it: the Durable must be reopened.
+// The failed operation itself is reverted in memory, but changes made directly on the
+// MultiIndex are not.
+type Durable[V comparable] struct {
+	m     *MultiIndex[V]
+	codec Codec[V]
+	dir   string
+	opts  DurableOptions
+
+	mu      sync.Mutex // guards the fields below, shared with the batch syncer
+	seg     *os.File
+	w       *bufio.Writer
+	segID   uint64
+	segSize int64
+	dirty   bool  // written but not synced
+	err     error // the first write error, after which the log is unusable
+	cancel  func()
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func segmentName(id uint64) string {
+	return fmt.Sprintf("wal-%016d.log", id)
+}
+
+func snapshotName(id uint64) string {
+	return fmt.Sprintf("snapshot-%016d.snap", id)
+}
+
+// listDurable returns the sorted IDs of snapshots and segments in `dir`
+func listDurable(dir string) (snapshots, segments []uint64, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasPrefix(name, "snapshot-") && strings.HasSuffix(name, ".snap"):
+			if id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "snapshot-"), ".snap"), 10, 64); err == nil {
+				snapshots = append(snapshots, id)
+			}
+		case strings.HasPrefix(name, "wal-") && strings.HasSuffix(name, ".log"):
+			if id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "wal-"), ".log"), 10, 64); err == nil {
+				segments = append(segments, id)
+			}
+		case strings.HasSuffix(name, ".tmp"):
+			// an interrupted Compact
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+	slices.Sort(snapshots)
+	slices.Sort(segments)
+	return
+}
+
+// OpenDurable restores `m`, which must be empty, from the latest snapshot in `dir` and the log
+// written after it, then logs every change of `m`. A damaged tail of the last segment, left by
+// a crash, is cut off. If `dir` holds nothing yet, the current content of `m` is snapshotted.
+// Recovery bypasses guards and constraints, so the Durables of MultiIndexes tied by foreign keys
+// can be opened in any order.
+//
+// Changes made directly on `m` (e.g. by ExpireBefore) are logged too, and written
+// by the next Durable operation or Sync.
+func OpenDurable[V comparable](dir string, m *MultiIndex[V], codec Codec[V], opts DurableOptions) (*Durable[V], error) {
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = 100 * time.Millisecond
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 64 << 20
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	snapshots, segments, err := listDurable(dir)
+	if err != nil {
+		return nil, err
+	}
+	fresh := len(snapshots) == 0 && len(segments) == 0
+	if !fresh && m.Size() != 0 {
+		return nil, errors.New("multiindex: OpenDurable needs an empty multiindex")
+	}
+
+	d := &Durable[V]{m: m, codec: codec, dir: dir, opts: opts}
+	if len(snapshots) > 0 {
+		d.segID = snapshots[len(snapshots)-1]
+		if err := d.loadSnapshot(d.segID); err != nil {
+			return nil, err
+		}
+	}
+	segments = slices.DeleteFunc(segments, func(id uint64) bool { return id < d.segID })
+	for i, id := range segments {
+		if err := d.replay(id, i == len(segments)-1); err != nil {
+			return nil, err
+		}
+		d.segID = id
+	}
+
+	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	d.seg, err = os.OpenFile(filepath.Join(dir, segmentName(d.segID)), flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := d.seg.Stat(); err == nil {
+		d.segSize = fi.Size()
+	}
+	d.w = bufio.NewWriter(d.seg)
+	d.cancel = m.Observe(d.record)
+
+	if fresh && m.Size() != 0 {
+		if err := d.Compact(); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	if opts.Sync == SyncBatch {
+		d.stop = make(chan struct{})
+		d.stopped = make(chan struct{})
+		go d.syncer()
+	}
+	return d, nil
+}
+
+func (d *Durable[V]) loadSnapshot(id uint64) error {
+	f, err := os.Open(filepath.Join(d.dir, snapshotName(id)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// as replay, unchecked: foreign keys may refer to MultiIndexes not restored yet
+	if err := d.m.loadSnapshot(f, d.codec, false); err != nil {
+		return fmt.Errorf("%s: %w", snapshotName(id), err)
+	}
+	return nil
+}
+
+// replay applies the records of segment `id`; a damaged tail of the last segment is truncated.
+// Records are applied without guards or constraints, so Durables may be opened in any order.
+func (d *Durable[V]) replay(id uint64, last bool) error {
+	path := filepath.Join(d.dir, segmentName(id))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for off := 0; off < len(data); {
+		payload, n := readRecord(data[off:])
+		if n == 0 {
+			if !last {
+				return fmt.Errorf("%w: %s at %d", ErrCorruptLog, segmentName(id), off)
+			}
+			return os.Truncate(path, int64(off))
+		}
+		c, err := decodeChange(d.codec, payload)
+		if err != nil {
+			return fmt.Errorf("multiindex: %s at %d: %w", segmentName(id), off, err)
+		}
+		if err := d.m.restore(c); err != nil {
+			return fmt.Errorf("multiindex: replaying %s at %d: %w", segmentName(id), off, err)
+		}
+		off += n
+	}
+	return nil
+}
+
+// readRecord returns the payload of the record at the start of `data` and the record length,
+// 0 if the record is truncated or damaged
+func readRecord(data []byte) ([]byte, int) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n) || uint64(len(data)-n)-size < 4 {
+		return nil, 0
+	}
+	end := n + int(size)
+	payload := data[n:end]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[end:]) {
+		return nil, 0
+	}
+	return payload, end + 4
+}
+
+// record is the observer of the MultiIndex
+func (d *Durable[V]) record(c Change[V]) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return
+	}
+	payload, err := encodeChange(d.codec, c)
+	if err != nil {
+		d.err = err
+		return
+	}
+	rec := binary.AppendUvarint(nil, uint64(len(payload)))
+	rec = append(rec, payload...)
+	rec = binary.BigEndian.AppendUint32(rec, crc32.ChecksumIEEE(payload))
+	if _, err := d.w.Write(rec); err != nil {
+		d.err = err
+		return
+	}
+	d.segSize += int64(len(rec))
+	d.dirty = true
+}
+
+// commit writes the pending records according to the sync policy
+func (d *Durable[V]) commit() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	if err := d.w.Flush(); err != nil {
+		d.err = err
+		return err
+	}
+	if d.opts.Sync == SyncAlways {
+		if err := d.syncLocked(); err != nil {
+			return err
+		}
+	}
+	if d.segSize >= d.opts.SegmentSize {
+		return d.rotateLocked(d.segID + 1)
+	}
+	return nil
+}
+
+func (d *Durable[V]) syncLocked() error {
+	if d.err != nil {
+		return d.err
+	}
+	if err := d.w.Flush(); err != nil {
+		d.err = err
+		return err
+	}
+	if d.dirty {
+		if err := d.seg.Sync(); err != nil {
+			d.err = err
+			return err
+		}
+		d.dirty = false
+	}
+	return nil
+}
+
+// rotateLocked continues the log in segment `id`
+func (d *Durable[V]) rotateLocked(id uint64) error {
+	if err := d.syncLocked(); err != nil {
+		return err
+	}
+	seg, err := os.OpenFile(filepath.Join(d.dir, segmentName(id)), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		d.err = err
+		return err
+	}
+	if err := syncDir(d.dir); err != nil {
+		seg.Close()
+		d.err = err
+		return err
+	}
+	d.seg.Close()
+	d.seg, d.segID, d.segSize = seg, id, 0
+	d.w.Reset(seg)
+	return nil
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func (d *Durable[V]) syncer() {
+	defer close(d.stopped)
+	ticker := time.NewTicker(d.opts.BatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.Sync()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *Durable[V]) Insert(v V) (ok bool, err error) {
+	err = d.do(func() error {
+		ok = d.m.Insert(v)
+		return nil
+	})
+	return ok, err
+}
+
+// Erase reports ErrNotFound if `v` is absent, or the guard refusing it (see TryErase)
+func (d *Durable[V]) Erase(v V) error {
+	return d.do(func() error { return d.m.TryErase(v) })
+}
+
+func (d *Durable[V]) Modify(old, new V) (ok bool, err error) {
+	err = d.do(func() error {
+		ok = d.m.Modify(old, new)
+		return nil
+	})
+	return ok, err
+}
+
+// do runs `op` and commits the records of its changes; an error of `op` is returned as is.
+// If a change cannot be recorded, the changes of `op` are reverted, so the MultiIndex
+// does not get ahead of the log. Once the log failed, no operation runs.
+func (d *Durable[V]) do(op func() error) error {
+	d.mu.Lock()
+	err := d.err
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var changes []Change[V]
+	cancel := d.m.Observe(func(c Change[V]) { changes = append(changes, c) })
+	opErr := op()
+	cancel()
+
+	d.mu.Lock()
+	err = d.err
+	d.mu.Unlock()
+	if err != nil {
+		for i := len(changes) - 1; i >= 0; i-- {
+			if d.m.restore(changes[i].Inverse()) != nil {
+				panic("multiindex: failed to revert a change the log did not record")
+			}
+		}
+		return err
+	}
+	if opErr != nil {
+		return opErr
+	}
+	return d.commit()
+}
+
+// Sync writes and fsyncs the pending records
+func (d *Durable[V]) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.syncLocked()
+}
+
+// Compact snapshots the MultiIndex and removes the log segments and snapshots it supersedes
+func (d *Durable[V]) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.syncLocked(); err != nil {
+		return err
+	}
+
+	next := d.segID + 1
+	tmp := filepath.Join(d.dir, snapshotName(next)+".tmp")
+	if err := d.writeSnapshot(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(d.dir, snapshotName(next))); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := d.rotateLocked(next); err != nil {
+		return err
+	}
+
+	snapshots, segments, err := listDurable(d.dir)
+	if err != nil {
+		return err
+	}
+	for _, id := range snapshots {
+		if id < next {
+			os.Remove(filepath.Join(d.dir, snapshotName(id)))
+		}
+	}
+	for _, id := range segments {
+		if id < next {
+			os.Remove(filepath.Join(d.dir, segmentName(id)))
+		}
+	}
+	return nil
+}
+
+func (d *Durable[V]) writeSnapshot(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := d.m.WriteSnapshot(f, d.codec); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close syncs the log and stops logging changes of the MultiIndex
+func (d *Durable[V]) Close() error {
+	if d.stop != nil {
+		close(d.stop)
+		<-d.stopped
+		d.stop = nil
+	}
+	d.cancel()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.syncLocked()
+	if cerr := d.seg.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,292 @@
+package multiindex
+
+import (
+	"container/heap"
+	"container/list"
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// ErrNoRoom is reported when a MultiIndex is at capacity and no element can be evicted,
+// e.g. because foreign keys restrict the erasure of all of them
+var ErrNoRoom = errors.New("multiindex: capacity reached, no element can be evicted")
+
+// EvictionPolicy chooses which element to drop once a MultiIndex exceeds its capacity
+type EvictionPolicy[V comparable] interface {
+	Inserted(v V)
+	Accessed(v V)
+	Erased(v V)
+	// Victims yields the elements in eviction order, the next one to evict first.
+	// The policy is not modified while the sequence is consumed.
+	Victims() iter.Seq[V]
+}
+
+// AccessObserver is implemented by indexes which report lookups (Find and Where) as accesses
+// to the eviction policy. Query results count too; traversals and the lookups made by foreign keys do not.
+type AccessObserver[V comparable] interface {
+	ObserveAccess(onAccess func(v V))
+}
+
+// SetCapacity limits the number of elements: inserts beyond `capacity` evict elements chosen by `policy`
+// from all indexes and report them to `onEvict` (may be nil). Victims whose erasure a guard refuses,
+// such as a restricting foreign key, are skipped; an insert for which no victim is left fails with ErrNoRoom.
+//
+// Elements already in `m` are registered in the policy in traversal order, and excess ones are evicted.
+// If they cannot be, SetCapacity fails with ErrNoRoom and changes nothing.
+// It panics if `capacity` is less than 1, since no element could be kept.
+func (m *MultiIndex[V]) SetCapacity(capacity int, policy EvictionPolicy[V], onEvict func(v V)) error {
+	if capacity < 1 {
+		panic("multiindex: capacity must be at least 1")
+	}
+	if len(m.MultiIndexBy) != 0 {
+		m.MultiIndexBy[m.primary()].TraversalValue(func(v V) bool {
+			policy.Inserted(v)
+			return true
+		})
+	}
+	prevCapacity, prevPolicy, prevOnEvict := m.capacity, m.policy, m.onEvict
+	m.capacity, m.policy, m.onEvict = capacity, policy, onEvict
+	victims, err := m.victims(m.Size()-capacity, nil)
+	if err != nil {
+		m.capacity, m.policy, m.onEvict = prevCapacity, prevPolicy, prevOnEvict
+		return err
+	}
+
+	for _, cont := range m.MultiIndexBy {
+		m.observeAccess(cont)
+	}
+	m.evict(victims)
+	return nil
+}
+
+// Touch reports an access to `v` made without going through an index
+func (m *MultiIndex[V]) Touch(v V) {
+	if m.policy != nil {
+		m.policy.Accessed(v)
+	}
+}
+
+func (m *MultiIndex[V]) observeAccess(cont MultiIndexByI[V]) {
+	if m.policy == nil {
+		return
+	}
+	if o, ok := cont.(AccessObserver[V]); ok {
+		o.ObserveAccess(m.Touch)
+	}
+}
+
+// victims returns the first `n` elements in eviction order which the guards allow to erase, except
+// those `keep` reports (may be nil). It changes nothing, and fails with ErrNoRoom if there are fewer.
+func (m *MultiIndex[V]) victims(n int, keep func(v V) bool) ([]V, error) {
+	if m.policy == nil || n <= 0 {
+		return nil, nil
+	}
+	var res []V
+	var refused error
+	for v := range m.policy.Victims() {
+		if keep != nil && keep(v) {
+			continue
+		}
+		if err := m.checkGuards(Change[V]{Op: OpErase, Old: v}); err != nil {
+			refused = err
+			continue
+		}
+		if res = append(res, v); len(res) == n {
+			return res, nil
+		}
+	}
+	if refused != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoRoom, refused)
+	}
+	return nil, ErrNoRoom
+}
+
+// evict erases `victims`, as returned by victims, and reports them to onEvict
+func (m *MultiIndex[V]) evict(victims []V) {
+	for _, v := range victims {
+		if _, err := m.tryErase(v); err != nil {
+			// already erased, or protected, by the erasure of a previous victim
+			continue
+		}
+		if m.onEvict != nil {
+			m.onEvict(v)
+		}
+	}
+}
+
+type listPolicy[V comparable] struct {
+	order      *list.List // front is the most recent
+	elems      map[V]*list.Element
+	moveOnRead bool
+}
+
+// NewLRU evicts the least recently inserted or accessed element
+func NewLRU[V comparable]() EvictionPolicy[V] {
+	return &listPolicy[V]{
+		order:      list.New(),
+		elems:      make(map[V]*list.Element),
+		moveOnRead: true,
+	}
+}
+
+// NewFIFO evicts the earliest inserted element
+func NewFIFO[V comparable]() EvictionPolicy[V] {
+	return &listPolicy[V]{
+		order: list.New(),
+		elems: make(map[V]*list.Element),
+	}
+}
+
+func (p *listPolicy[V]) Inserted(v V) {
+	if e, ok := p.elems[v]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.elems[v] = p.order.PushFront(v)
+}
+
+func (p *listPolicy[V]) Accessed(v V) {
+	if e, ok := p.elems[v]; ok && p.moveOnRead {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *listPolicy[V]) Erased(v V) {
+	if e, ok := p.elems[v]; ok {
+		p.order.Remove(e)
+		delete(p.elems, v)
+	}
+}
+
+func (p *listPolicy[V]) Victims() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for e := p.order.Back(); e != nil; e = e.Prev() {
+			if !yield(e.Value.(V)) {
+				return
+			}
+		}
+	}
+}
+
+type lfuEntry[V comparable] struct {
+	value V
+	freq  int
+	seq   uint64
+	index int
+}
+
+type lfuHeap[V comparable] []*lfuEntry[V]
+
+func (h lfuHeap[V]) Len() int { return len(h) }
+
+func (h lfuHeap[V]) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h lfuHeap[V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[V]) Push(x any) {
+	e := x.(*lfuEntry[V])
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap[V]) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+type lfuPolicy[V comparable] struct {
+	heap  lfuHeap[V]
+	elems map[V]*lfuEntry[V]
+	seq   uint64
+}
+
+// NewLFU evicts the least frequently accessed element; ties go to the least recently used one
+func NewLFU[V comparable]() EvictionPolicy[V] {
+	return &lfuPolicy[V]{
+		elems: make(map[V]*lfuEntry[V]),
+	}
+}
+
+func (p *lfuPolicy[V]) Inserted(v V) {
+	p.seq++
+	if e, ok := p.elems[v]; ok {
+		e.freq++
+		e.seq = p.seq
+		heap.Fix(&p.heap, e.index)
+		return
+	}
+	e := &lfuEntry[V]{value: v, freq: 1, seq: p.seq}
+	p.elems[v] = e
+	heap.Push(&p.heap, e)
+}
+
+func (p *lfuPolicy[V]) Accessed(v V) {
+	e, ok := p.elems[v]
+	if !ok {
+		return
+	}
+	p.seq++
+	e.freq++
+	e.seq = p.seq
+	heap.Fix(&p.heap, e.index)
+}
+
+func (p *lfuPolicy[V]) Erased(v V) {
+	e, ok := p.elems[v]
+	if !ok {
+		return
+	}
+	heap.Remove(&p.heap, e.index)
+	delete(p.elems, v)
+}
+
+// Victims walks the heap in order without modifying it: the next entry is the least one
+// of a frontier holding the children of the entries already yielded
+func (p *lfuPolicy[V]) Victims() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		if len(p.heap) == 0 {
+			return
+		}
+		frontier := &lfuFrontier[V]{heap: p.heap, indexes: []int{0}}
+		for frontier.Len() > 0 {
+			i := heap.Pop(frontier).(int)
+			if !yield(p.heap[i].value) {
+				return
+			}
+			for _, child := range []int{2*i + 1, 2*i + 2} {
+				if child < len(p.heap) {
+					heap.Push(frontier, child)
+				}
+			}
+		}
+	}
+}
+
+// lfuFrontier is a heap of positions in an lfuHeap, ordered as their entries
+type lfuFrontier[V comparable] struct {
+	heap    lfuHeap[V]
+	indexes []int
+}
+
+func (f *lfuFrontier[V]) Len() int           { return len(f.indexes) }
+func (f *lfuFrontier[V]) Less(i, j int) bool { return f.heap.Less(f.indexes[i], f.indexes[j]) }
+func (f *lfuFrontier[V]) Swap(i, j int)      { f.indexes[i], f.indexes[j] = f.indexes[j], f.indexes[i] }
+func (f *lfuFrontier[V]) Push(x any)         { f.indexes = append(f.indexes, x.(int)) }
+
+func (f *lfuFrontier[V]) Pop() any {
+	i := f.indexes[len(f.indexes)-1]
+	f.indexes = f.indexes[:len(f.indexes)-1]
+	return i
+}
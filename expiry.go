@@ -0,0 +1,93 @@
+package multiindex
+
+import (
+	"sync"
+	"time"
+)
+
+// Expirer is implemented by indexes which know when their elements expire (see multiindex_container.NewExpiry)
+type Expirer[V comparable] interface {
+	ExpiredBefore(t time.Time) []V
+}
+
+// Clock abstracts time for the janitor, so tests can drive it with a fake one
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// ExpireBefore erases elements expiring before `t` from all indexes and returns them
+func (m *MultiIndex[V]) ExpireBefore(t time.Time) []V {
+	var expired []V
+	for _, cont := range m.MultiIndexBy {
+		e, ok := cont.(Expirer[V])
+		if !ok {
+			continue
+		}
+		for _, v := range e.ExpiredBefore(t) {
+			if m.TryErase(v) != nil {
+				// already erased through another expiry index, or restricted by a foreign key
+				continue
+			}
+			expired = append(expired, v)
+		}
+	}
+	return expired
+}
+
+// StartJanitor calls ExpireBefore(clock.Now()) every `interval` until `stop` is called.
+// `lock` (may be nil) is held while expiring; it must be the lock guarding every other use of `m`.
+// `onExpire` (may be nil) is called for every evicted element, with `lock` held.
+func (m *MultiIndex[V]) StartJanitor(
+	clock Clock,
+	interval time.Duration,
+	lock sync.Locker,
+	onExpire func(v V),
+) (stop func()) {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-done:
+				return
+			case <-clock.After(interval):
+			}
+
+			if lock != nil {
+				lock.Lock()
+			}
+			for _, v := range m.ExpireBefore(clock.Now()) {
+				if onExpire != nil {
+					onExpire(v)
+				}
+			}
+			if lock != nil {
+				lock.Unlock()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package multiindex
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+)
+
+type OnDelete int
+
+const (
+	Restrict OnDelete = iota // a parent with children cannot be erased
+	Cascade                  // the children are erased with their parent
+	SetNull                  // the key of the children is cleared with ForeignKeyOptions.SetNull
+)
+
+// KeyFinder is implemented by unique indexes, such as multiindex_container.NewOrderedUnique
+type KeyFinder[K, V comparable] interface {
+	Find(key K) ConstIterator[V]
+}
+
+// KeyWhere is implemented by non-unique indexes, such as multiindex_container.NewNonOrderedNonUnique
+type KeyWhere[K, V comparable] interface {
+	Where(key K) iter.Seq[V]
+}
+
+// KeyTraverser is implemented by non-unique indexes; unlike Where, TraversalWithKey is not an access
+// for the eviction policy, so that checking a foreign key leaves the children's policy alone
+type KeyTraverser[K, V comparable] interface {
+	TraversalWithKey(key K, visitor func(v V) bool)
+}
+
+type ForeignKeyOptions[C, K comparable] struct {
+	OnDelete OnDelete
+	// SetNull returns the child with a zero key, for OnDelete SetNull
+	SetNull func(c C) C
+	// ChildIndex is an index of the children on their key, to find them without a full scan
+	ChildIndex KeyTraverser[K, C]
+}
+
+// ForeignKey ties the key of children to a unique key of parents in another MultiIndex, see NewForeignKey
+type ForeignKey[C, P, K comparable] struct {
+	name      string
+	child     *MultiIndex[C]
+	childKey  func(c C) K
+	parent    *MultiIndex[P]
+	parentIdx KeyFinder[K, P]
+	parentKey func(p P) K
+	opts      ForeignKeyOptions[C, K]
+	cancel    func()
+}
+
+// NewForeignKey requires every child of `child` with a non-zero `childKey` to have a parent
+// in `parentIdx`, a unique index of `parent` on `parentKey`, e.g. the author of every book:
+//
+//	multiindex.NewForeignKey("book author", books, func(b Book) string { return b.Author },
+//		authors, byName, func(a Author) string { return a.Name }, multiindex.ForeignKeyOptions[Book, string]{})
+//
+// Inserting an orphan child fails with *ConstraintError, as does erasing a parent with children
+// under Restrict. Whatever the policy, the key of a parent with children cannot be modified.
+// It fails if `child` already holds orphans.
+func NewForeignKey[C, P, K comparable](
+	name string,
+	child *MultiIndex[C], childKey func(c C) K,
+	parent *MultiIndex[P], parentIdx KeyFinder[K, P], parentKey func(p P) K,
+	opts ForeignKeyOptions[C, K],
+) (*ForeignKey[C, P, K], error) {
+	if opts.OnDelete == SetNull && opts.SetNull == nil {
+		return nil, errors.New("multiindex: SetNull needs ForeignKeyOptions.SetNull")
+	}
+	fk := &ForeignKey[C, P, K]{
+		name:      name,
+		child:     child,
+		childKey:  childKey,
+		parent:    parent,
+		parentIdx: parentIdx,
+		parentKey: parentKey,
+		opts:      opts,
+	}
+	if err := child.AddCheck(name, fk.hasParent); err != nil {
+		return nil, err
+	}
+	fk.cancel = parent.addGuard(fk.check, fk.apply)
+	return fk, nil
+}
+
+func (fk *ForeignKey[C, P, K]) hasParent(c C) bool {
+	var null K
+	k := fk.childKey(c)
+	if k == null {
+		return true
+	}
+	it := fk.parentIdx.Find(k)
+	return it != nil && it.IsValid()
+}
+
+// Parent returns the parent of `c`
+func (fk *ForeignKey[C, P, K]) Parent(c C) (p P, ok bool) {
+	var null K
+	k := fk.childKey(c)
+	if k == null {
+		return
+	}
+	return peek(fk.parentIdx.Find(k))
+}
+
+// Children returns the children of `p`
+func (fk *ForeignKey[C, P, K]) Children(p P) []C {
+	k := fk.parentKey(p)
+	var res []C
+	if fk.opts.ChildIndex != nil {
+		fk.opts.ChildIndex.TraversalWithKey(k, func(c C) bool {
+			res = append(res, c)
+			return true
+		})
+		return res
+	}
+	if len(fk.child.MultiIndexBy) == 0 {
+		return nil
+	}
+	fk.child.MultiIndexBy[fk.child.primary()].TraversalValue(func(c C) bool {
+		if fk.childKey(c) == k {
+			res = append(res, c)
+		}
+		return true
+	})
+	return res
+}
+
+// check tells whether the policy allows erasing or modifying a parent, without changing the children
+func (fk *ForeignKey[C, P, K]) check(c Change[P]) error {
+	if c.Op == OpModify && fk.parentKey(c.Old) == fk.parentKey(c.New) {
+		return nil
+	}
+	children := fk.Children(c.Old)
+	if len(children) == 0 {
+		return nil
+	}
+	if c.Op == OpModify || fk.opts.OnDelete == Restrict {
+		return &ConstraintError{fk.name, fmt.Sprintf("%v is referenced by %d elements", c.Old, len(children))}
+	}
+	for _, ch := range children {
+		if err := fk.child.checkGuards(fk.childChange(ch)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// childChange returns the change of child `ch` when its parent is erased
+func (fk *ForeignKey[C, P, K]) childChange(ch C) Change[C] {
+	if fk.opts.OnDelete == Cascade {
+		return Change[C]{Op: OpErase, Old: ch}
+	}
+	return Change[C]{Op: OpModify, Old: ch, New: fk.opts.SetNull(ch)}
+}
+
+// apply erases or clears the children of an erased parent, once all guards of the parent passed
+func (fk *ForeignKey[C, P, K]) apply(c Change[P]) (undo func(), err error) {
+	if c.Op != OpErase || fk.opts.OnDelete == Restrict {
+		return nil, nil
+	}
+	var undos []func()
+	undo = func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+	for _, ch := range fk.Children(c.Old) {
+		change := fk.childChange(ch)
+		if change.Op == OpErase {
+			u, err := fk.child.tryErase(ch)
+			if err != nil {
+				undo()
+				return nil, err
+			}
+			undos = append(undos, u)
+			continue
+		}
+		if err := fk.child.Apply(change); err != nil {
+			undo()
+			return nil, fmt.Errorf("multiindex: %s: clearing the key of %v: %w", fk.name, ch, err)
+		}
+		undos = append(undos, func() {
+			if fk.child.Apply(change.Inverse()) != nil {
+				panic("multiindex: failed to restore the key of a child")
+			}
+		})
+	}
+	return undo, nil
+}
+
+// Close stops enforcing the foreign key
+func (fk *ForeignKey[C, P, K]) Close() {
+	fk.cancel()
+	fk.child.RemoveConstraint(fk.name)
+}
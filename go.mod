@@ -1,5 +1,7 @@
 module github.com/agmt/go-multiindex
 
-go 1.23
+go 1.23.0
 
 require github.com/liyue201/gostl v1.2.0
+
+require golang.org/x/text v0.28.0
@@ -35,6 +35,11 @@ func (iter *RbTreeIterator[K, V]) Prev() iterator.ConstBidIterator[V] {
 	return iter
 }
 
+// Node returns the node the iterator points to
+func (iter *RbTreeIterator[K, V]) Node() *Node[K, V] {
+	return iter.node
+}
+
 // Key returns the node's key of the iterator point to
 func (iter *RbTreeIterator[K, V]) Key() K {
 	return iter.node.Key()
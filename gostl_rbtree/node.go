@@ -34,6 +34,21 @@ func (n *Node[K, V]) SetValue(val V) {
 	n.value = val
 }
 
+// Left returns node's left child
+func (n *Node[K, V]) Left() *Node[K, V] {
+	return n.left
+}
+
+// Right returns node's right child
+func (n *Node[K, V]) Right() *Node[K, V] {
+	return n.right
+}
+
+// Parent returns node's parent
+func (n *Node[K, V]) Parent() *Node[K, V] {
+	return n.parent
+}
+
 // Next returns the Node's successor as an iterator.
 func (n *Node[K, V]) Next() *Node[K, V] {
 	return successor(n)
@@ -5,6 +5,7 @@ package rbtree
 import (
 	"errors"
 	"fmt"
+	"math/bits"
 
 	"github.com/liyue201/gostl/utils/comparator"
 	"github.com/liyue201/gostl/utils/visitor"
@@ -17,9 +18,10 @@ var ErrorNotFound = errors.New("not found")
 // as the color (red or black) of the node. These color bits are used to ensure the tree
 // remains approximately balanced during insertions and deletions.
 type RbTree[K, V any] struct {
-	root   *Node[K, V]
-	size   int
-	keyCmp comparator.Comparator[K]
+	root    *Node[K, V]
+	size    int
+	keyCmp  comparator.Comparator[K]
+	augment func(n *Node[K, V])
 }
 
 // New creates a new RbTree
@@ -27,6 +29,17 @@ func New[K, V any](cmp comparator.Comparator[K]) *RbTree[K, V] {
 	return &RbTree[K, V]{keyCmp: cmp}
 }
 
+// SetAugment installs a callback which recomputes per-node data (e.g. a subtree maximum kept in the value)
+// from the node itself and its children. It is called bottom-up for every node whose subtree changed.
+func (t *RbTree[K, V]) SetAugment(augment func(n *Node[K, V])) {
+	t.augment = augment
+}
+
+// Root returns the root node of the RbTree
+func (t *RbTree[K, V]) Root() *Node[K, V] {
+	return t.root
+}
+
 // Clear clears the RbTree
 func (t *RbTree[K, V]) Clear() {
 	t.root = nil
@@ -113,6 +126,7 @@ func (t *RbTree[K, V]) Insert(key K, value V) *Node[K, V] {
 	if y == nil {
 		z.color = BLACK
 		t.root = z
+		t.augmentPath(z)
 		return z
 	} else if t.keyCmp(z.key, y.key) < 0 {
 		y.left = z
@@ -120,9 +134,33 @@ func (t *RbTree[K, V]) Insert(key K, value V) *Node[K, V] {
 		y.right = z
 	}
 	t.rbInsertFixup(z)
+	t.augmentPath(z)
 	return z
 }
 
+// BuildSorted replaces the content of the RbTree with `keys` and `values`, which must be sorted by key.
+// It takes O(n), while n inserts take O(n*log(n)).
+func (t *RbTree[K, V]) BuildSorted(keys []K, values []V) {
+	// all levels but the deepest are full, the nodes of the deepest one are red
+	t.root = t.buildSorted(keys, values, nil, 0, bits.Len(uint(len(keys)))-1)
+	t.size = len(keys)
+}
+
+func (t *RbTree[K, V]) buildSorted(keys []K, values []V, parent *Node[K, V], depth, maxDepth int) *Node[K, V] {
+	if len(keys) == 0 {
+		return nil
+	}
+	mid := len(keys) / 2
+	n := &Node[K, V]{parent: parent, color: BLACK, key: keys[mid], value: values[mid]}
+	if depth > 0 && depth == maxDepth {
+		n.color = RED
+	}
+	n.left = t.buildSorted(keys[:mid], values[:mid], n, depth+1, maxDepth)
+	n.right = t.buildSorted(keys[mid+1:], values[mid+1:], n, depth+1, maxDepth)
+	t.augmentNode(n)
+	return n
+}
+
 func (t *RbTree[K, V]) rbInsertFixup(z *Node[K, V]) {
 	var y *Node[K, V]
 	for z.parent != nil && !z.parent.color {
@@ -208,6 +246,11 @@ func (t *RbTree[K, V]) Delete(node *Node[K, V]) {
 	if y.color {
 		t.rbDeleteFixup(x, xparent)
 	}
+	if xparent != nil {
+		t.augmentPath(xparent)
+	} else if x != nil {
+		t.augmentPath(x)
+	}
 	t.size--
 }
 
@@ -306,6 +349,8 @@ func (t *RbTree[K, V]) leftRotate(x *Node[K, V]) {
 	}
 	y.left = x
 	x.parent = y
+	t.augmentNode(x)
+	t.augmentNode(y)
 }
 
 func (t *RbTree[K, V]) rightRotate(x *Node[K, V]) {
@@ -324,6 +369,24 @@ func (t *RbTree[K, V]) rightRotate(x *Node[K, V]) {
 	}
 	y.right = x
 	x.parent = y
+	t.augmentNode(x)
+	t.augmentNode(y)
+}
+
+func (t *RbTree[K, V]) augmentNode(n *Node[K, V]) {
+	if t.augment != nil {
+		t.augment(n)
+	}
+}
+
+// augmentPath refreshes augmented data from `n` up to the root
+func (t *RbTree[K, V]) augmentPath(n *Node[K, V]) {
+	if t.augment == nil {
+		return
+	}
+	for ; n != nil; n = n.parent {
+		t.augment(n)
+	}
 }
 
 // findNode finds the node that its key is equal to the passed key, and returns it.
@@ -0,0 +1,167 @@
+package multiindex
+
+import (
+	"errors"
+	"slices"
+)
+
+var (
+	// ErrNoHistory is reported by Undo and Redo when there is nothing to undo or redo
+	ErrNoHistory = errors.New("multiindex: no history")
+	// ErrUnknownCheckpoint is reported for a checkpoint never set or no longer in the history
+	ErrUnknownCheckpoint = errors.New("multiindex: unknown checkpoint")
+)
+
+// History records the changes of a MultiIndex to undo and redo them.
+// It must be used under the lock guarding the MultiIndex, if any.
+type History[V comparable] struct {
+	m           *MultiIndex[V]
+	depth       int
+	done        []Change[V] // oldest first
+	undone      []Change[V] // most recently undone last
+	base        int         // the number of changes dropped from done
+	checkpoints map[string]int
+	applying    bool
+	cancel      func()
+}
+
+// NewHistory starts recording changes of `m`; only the last `depth` changes are kept, all if `depth` is 0
+func NewHistory[V comparable](m *MultiIndex[V], depth int) *History[V] {
+	h := &History[V]{m: m, depth: depth, checkpoints: map[string]int{}}
+	h.cancel = m.Observe(h.record)
+	return h
+}
+
+func (h *History[V]) record(c Change[V]) {
+	if h.applying {
+		return
+	}
+	pos := h.pos()
+	for label, p := range h.checkpoints {
+		if p > pos {
+			delete(h.checkpoints, label)
+		}
+	}
+	h.undone = nil
+	h.done = append(h.done, c)
+	if h.depth > 0 && len(h.done) > h.depth {
+		drop := len(h.done) - h.depth
+		h.done = slices.Delete(h.done, 0, drop)
+		h.base += drop
+		for label, p := range h.checkpoints {
+			if p < h.base {
+				delete(h.checkpoints, label)
+			}
+		}
+	}
+}
+
+// pos returns the number of changes recorded and not undone, dropped ones included
+func (h *History[V]) pos() int {
+	return h.base + len(h.done)
+}
+
+// CanUndo returns the number of changes which can be undone
+func (h *History[V]) CanUndo() int {
+	return len(h.done)
+}
+
+// CanRedo returns the number of changes which can be redone
+func (h *History[V]) CanRedo() int {
+	return len(h.undone)
+}
+
+// Undo reverts the last change; an eviction is a change of its own
+func (h *History[V]) Undo() error {
+	return h.undo(1)
+}
+
+// Redo performs again the last undone change
+func (h *History[V]) Redo() error {
+	return h.redo(1)
+}
+
+// Checkpoint labels the current state, to return to it with UndoTo or RedoTo.
+// A label is set again if reused.
+func (h *History[V]) Checkpoint(label string) {
+	h.checkpoints[label] = h.pos()
+}
+
+// UndoTo reverts all changes after checkpoint `label`, at once: if one of them fails, none is reverted
+func (h *History[V]) UndoTo(label string) error {
+	p, ok := h.checkpoints[label]
+	if !ok || p > h.pos() {
+		return ErrUnknownCheckpoint
+	}
+	return h.undo(h.pos() - p)
+}
+
+// RedoTo performs again all undone changes up to checkpoint `label`, at once
+func (h *History[V]) RedoTo(label string) error {
+	p, ok := h.checkpoints[label]
+	if !ok || p < h.pos() {
+		return ErrUnknownCheckpoint
+	}
+	return h.redo(p - h.pos())
+}
+
+func (h *History[V]) undo(n int) error {
+	if n > len(h.done) {
+		return ErrNoHistory
+	}
+	changes := slices.Clone(h.done[len(h.done)-n:])
+	slices.Reverse(changes)
+	for i := range changes {
+		changes[i] = changes[i].Inverse()
+	}
+	if err := h.apply(changes); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		h.undone = append(h.undone, h.done[len(h.done)-1-i])
+	}
+	h.done = h.done[:len(h.done)-n]
+	return nil
+}
+
+func (h *History[V]) redo(n int) error {
+	if n > len(h.undone) {
+		return ErrNoHistory
+	}
+	changes := slices.Clone(h.undone[len(h.undone)-n:])
+	slices.Reverse(changes)
+	if err := h.apply(changes); err != nil {
+		return err
+	}
+	h.done = append(h.done, changes...)
+	h.undone = h.undone[:len(h.undone)-n]
+	return nil
+}
+
+// apply applies `changes` in order, reverting the applied ones if one fails
+func (h *History[V]) apply(changes []Change[V]) error {
+	h.applying = true
+	defer func() { h.applying = false }()
+	for i, c := range changes {
+		if err := h.m.Apply(c); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if h.m.Apply(changes[j].Inverse()) != nil {
+					panic("multiindex: failed to revert a partial undo")
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear forgets all recorded changes and checkpoints
+func (h *History[V]) Clear() {
+	h.done, h.undone, h.base = nil, nil, 0
+	clear(h.checkpoints)
+}
+
+// Close stops recording
+func (h *History[V]) Close() {
+	h.cancel()
+}
@@ -0,0 +1,102 @@
+package multiindex
+
+import (
+	"iter"
+	"slices"
+)
+
+// JoinIndex is an index listing its elements with their keys, as containers do with All
+type JoinIndex[K, V comparable] interface {
+	All() iter.Seq2[K, V]
+}
+
+// KeyComparer is implemented by ordered indexes, whose All lists keys in this order
+type KeyComparer[K any] interface {
+	CompareKeys(a, b K) int
+}
+
+// Join returns the pairs of elements of `left` and `right` with equal keys, in the order of `left`.
+// If both indexes are ordered (KeyComparer, which must agree on the order) they are merged;
+// otherwise `right` is looked up with Where if it has it, or hashed.
+func Join[K, L, R comparable](left JoinIndex[K, L], right JoinIndex[K, R]) iter.Seq2[L, R] {
+	return join(left, right, false)
+}
+
+// LeftJoin is Join also returning the elements of `left` without a match, paired with a zero R
+func LeftJoin[K, L, R comparable](left JoinIndex[K, L], right JoinIndex[K, R]) iter.Seq2[L, R] {
+	return join(left, right, true)
+}
+
+func join[K, L, R comparable](left JoinIndex[K, L], right JoinIndex[K, R], outer bool) iter.Seq2[L, R] {
+	lc, lordered := left.(KeyComparer[K])
+	_, rordered := right.(KeyComparer[K])
+	if lordered && rordered {
+		return mergeJoin(left, right, lc.CompareKeys, outer)
+	}
+	return func(yield func(L, R) bool) {
+		var lookup func(k K) iter.Seq[R]
+		if w, ok := right.(KeyWhere[K, R]); ok {
+			lookup = w.Where
+		} else {
+			hashed := map[K][]R{}
+			for k, r := range right.All() {
+				hashed[k] = append(hashed[k], r)
+			}
+			lookup = func(k K) iter.Seq[R] {
+				return slices.Values(hashed[k])
+			}
+		}
+
+		for k, l := range left.All() {
+			matched := false
+			for r := range lookup(k) {
+				matched = true
+				if !yield(l, r) {
+					return
+				}
+			}
+			if outer && !matched {
+				var zero R
+				if !yield(l, zero) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func mergeJoin[K, L, R comparable](left JoinIndex[K, L], right JoinIndex[K, R], cmp func(a, b K) int, outer bool) iter.Seq2[L, R] {
+	return func(yield func(L, R) bool) {
+		next, stop := iter.Pull2(right.All())
+		defer stop()
+		rk, rv, rok := next()
+
+		var group []R // the elements of `right` with key `gk`
+		var gk K
+		grouped := false
+		for lk, lv := range left.All() {
+			if !grouped || cmp(gk, lk) != 0 {
+				for rok && cmp(rk, lk) < 0 {
+					rk, rv, rok = next()
+				}
+				group = group[:0]
+				for rok && cmp(rk, lk) == 0 {
+					group = append(group, rv)
+					rk, rv, rok = next()
+				}
+				gk, grouped = lk, true
+			}
+			for _, r := range group {
+				if !yield(lv, r) {
+					return
+				}
+			}
+			if outer && len(group) == 0 {
+				var zero R
+				if !yield(lv, zero) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -1,6 +1,28 @@
 package multiindex
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrRejected is reported when an index refuses an element (e.g. a duplicate key in a unique index)
+var ErrRejected = errors.New("rejected by index")
+
+// IndexError tells which index caused an error
+type IndexError struct {
+	Index string
+	Err   error
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("multiindex: index %s: %v", e.Index, e.Err)
+}
+
+func (e *IndexError) Unwrap() error {
+	return e.Err
+}
 
 type ConstIterator[V comparable] interface {
 	IsValid() bool
@@ -17,9 +39,29 @@ type MultiIndexByI[V comparable] interface {
 	TraversalValue(cb func(v V) bool)
 }
 
+// Partial is implemented by indexes which hold only a subset of elements (see multiindex_container.Filter).
+// Insert into a partial index succeeds for rejected elements without storing them.
+// A MultiIndex needs at least one index which is not partial.
+type Partial[V comparable] interface {
+	Accepts(v V) bool
+}
+
 // All `V` should be different (or use *V)
 type MultiIndex[V comparable] struct {
 	MultiIndexBy []MultiIndexByI[V] // rbtree
+	names        []string           // parallel to MultiIndexBy, "" for unnamed indexes
+
+	capacity int
+	policy   EvictionPolicy[V]
+	onEvict  func(v V)
+
+	observers []*observer[V]
+
+	constraints []constraint[V]
+	guards      []*guard[V]
+
+	versions    map[V]uint64 // nil unless EnableVersions was called
+	lastVersion uint64
 }
 
 func New[V comparable]() *MultiIndex[V] {
@@ -29,31 +71,120 @@ func New[V comparable]() *MultiIndex[V] {
 }
 
 func (m *MultiIndex[V]) Insert(v V) bool {
+	return m.TryInsert(v) == nil
+}
+
+// TryInsert is Insert reporting which index rejected `v` as *IndexError,
+// or the violated constraint as *ConstraintError, or ErrNoRoom if no element can be evicted to make room for it
+func (m *MultiIndex[V]) TryInsert(v V) error {
+	if err := m.insert(v); err != nil {
+		return err
+	}
+	victims, err := m.victims(m.Size()-m.capacity, func(victim V) bool { return victim == v })
+	if err != nil {
+		m.erase(v)
+		return err
+	}
+	m.notify(Change[V]{Op: OpInsert, New: v})
+	m.evict(victims)
+	return nil
+}
+
+// insert adds `v` to all indexes and to the eviction policy, without evicting
+func (m *MultiIndex[V]) insert(v V) error {
+	return m.insertChecked(v, true)
+}
+
+// insertChecked is insert, checking the constraints only if `checked` is set
+func (m *MultiIndex[V]) insertChecked(v V, checked bool) error {
 	if len(m.MultiIndexBy) == 0 {
 		panic("multiindex has no indexes")
 	}
+	m.primary() // panics if every index is partial
+	if checked {
+		if err := m.checkConstraints(v, false); err != nil {
+			return err
+		}
+	}
 
 	for i := 0; i < len(m.MultiIndexBy); i++ {
 		cont := m.MultiIndexBy[i]
 		it := cont.Insert(v)
 		if it == nil || !it.IsValid() {
-			// rollback
-			for j := 0; j < i; j++ {
-				it := m.MultiIndexBy[j].FindValue(v)
-				m.MultiIndexBy[j].Erase_Internal(it)
-			}
-			return false
+			m.rollback(v, i)
+			return &IndexError{Index: m.IndexName(i), Err: ErrRejected}
+		}
+	}
+	if checked {
+		if err := m.checkConstraints(v, true); err != nil {
+			m.rollback(v, len(m.MultiIndexBy))
+			return err
 		}
 	}
 
-	return true
+	if m.policy != nil {
+		m.policy.Inserted(v)
+	}
+	return nil
+}
+
+// rollback erases `v` from the first `n` indexes
+func (m *MultiIndex[V]) rollback(v V, n int) {
+	for j := 0; j < n; j++ {
+		it := m.MultiIndexBy[j].FindValue(v)
+		if it == nil || !it.IsValid() {
+			continue
+		}
+		m.MultiIndexBy[j].Erase_Internal(it)
+	}
 }
 
 func (m *MultiIndex[V]) Erase(v V) {
+	m.TryErase(v)
+}
+
+// TryErase is Erase reporting ErrNotFound if `v` is absent,
+// or the error of a foreign key restricting its removal (see NewForeignKey)
+func (m *MultiIndex[V]) TryErase(v V) error {
+	_, err := m.tryErase(v)
+	return err
+}
+
+// tryErase is TryErase returning a function which inserts `v` back and undoes
+// the actions of the guards, e.g. cascades
+func (m *MultiIndex[V]) tryErase(v V) (undo func(), err error) {
+	undoGuards, err := m.eraseGuarded(v)
+	if err != nil {
+		return nil, err
+	}
+	m.notify(Change[V]{Op: OpErase, Old: v})
+	return func() {
+		if m.Apply(Change[V]{Op: OpInsert, New: v}) != nil {
+			panic("multiindex: failed to restore an erased element")
+		}
+		undoGuards()
+	}, nil
+}
+
+// eraseGuarded erases `v` if the guards allow it, without notifying
+func (m *MultiIndex[V]) eraseGuarded(v V) (undoGuards func(), err error) {
+	if !m.Contains(v) {
+		return nil, ErrNotFound
+	}
+	undoGuards, err = m.guard(Change[V]{Op: OpErase, Old: v})
+	if err != nil {
+		return nil, err
+	}
+	m.erase(v)
+	return undoGuards, nil
+}
+
+func (m *MultiIndex[V]) erase(v V) bool {
 	if len(m.MultiIndexBy) == 0 {
 		panic("multiindex has no indexes")
 	}
 
+	erased := false
 	for i := 0; i < len(m.MultiIndexBy); i++ {
 		cont := m.MultiIndexBy[i]
 		it := cont.FindValue(v)
@@ -62,7 +193,53 @@ func (m *MultiIndex[V]) Erase(v V) {
 			continue
 		}
 		cont.Erase_Internal(it)
+		erased = true
 	}
+
+	if erased && m.policy != nil {
+		m.policy.Erased(v)
+	}
+	return erased
+}
+
+// Modify replaces `old` with `new` in all indexes.
+// If `old` is absent or `new` is rejected by some index, nothing is changed.
+func (m *MultiIndex[V]) Modify(old, new V) bool {
+	if m.modify(old, new) != nil {
+		return false
+	}
+	m.notify(Change[V]{Op: OpModify, Old: old, New: new})
+	return true
+}
+
+// modify replaces `old` with `new` without notifying; the size does not change, so nothing is evicted
+func (m *MultiIndex[V]) modify(old, new V) error {
+	if !m.Contains(old) {
+		return ErrNotFound
+	}
+	undoGuards, err := m.guard(Change[V]{Op: OpModify, Old: old, New: new})
+	if err != nil {
+		return err
+	}
+
+	m.erase(old)
+	if err := m.insert(new); err != nil {
+		if m.insert(old) != nil {
+			panic("multiindex: failed to restore element after rejected Modify")
+		}
+		undoGuards()
+		return err
+	}
+	return nil
+}
+
+func (m MultiIndex[V]) Contains(v V) bool {
+	if len(m.MultiIndexBy) == 0 {
+		return false
+	}
+
+	it := m.MultiIndexBy[m.primary()].FindValue(v)
+	return it != nil && it.IsValid() && it.Value() == v
 }
 
 func (m MultiIndex[V]) Size() int {
@@ -70,12 +247,77 @@ func (m MultiIndex[V]) Size() int {
 		return 0
 	}
 
-	return m.MultiIndexBy[0].Size()
+	return m.MultiIndexBy[m.primary()].Size()
+}
+
+// primary returns the first index holding all elements; a MultiIndex with only partial indexes
+// cannot tell its elements, so it panics
+func (m MultiIndex[V]) primary() int {
+	for i, cont := range m.MultiIndexBy {
+		if _, ok := cont.(Partial[V]); !ok {
+			return i
+		}
+	}
+	panic("multiindex has only partial indexes")
 }
 
 // ToDo: if `m` is non-empty, all existing elements should be indexed in `mib`
 func (m *MultiIndex[V]) AddIndex(mib ...MultiIndexByI[V]) error {
 	m.MultiIndexBy = append(m.MultiIndexBy, mib...)
+	for _, cont := range mib {
+		m.observeAccess(cont)
+	}
+	return nil
+}
+
+// AddNamedIndex is AddIndex registering `mib` under `name` for Index and error messages
+func (m *MultiIndex[V]) AddNamedIndex(name string, mib MultiIndexByI[V]) error {
+	if name == "" {
+		return errors.New("multiindex: empty index name")
+	}
+	if m.Index(name) != nil {
+		return fmt.Errorf("multiindex: index %s already exists", name)
+	}
+	for len(m.names) < len(m.MultiIndexBy) {
+		m.names = append(m.names, "")
+	}
+	m.names = append(m.names, name)
+	return m.AddIndex(mib)
+}
+
+// Index returns the index registered as `name`, or nil
+func (m MultiIndex[V]) Index(name string) MultiIndexByI[V] {
+	for i, n := range m.names {
+		if n == name && i < len(m.MultiIndexBy) {
+			return m.MultiIndexBy[i]
+		}
+	}
+	return nil
+}
+
+// IndexName returns the name of the i-th index, or its position if it is unnamed
+func (m MultiIndex[V]) IndexName(i int) string {
+	if i < len(m.names) && m.names[i] != "" {
+		return m.names[i]
+	}
+	return strconv.Itoa(i)
+}
+
+// Dump writes every index with its elements, for debugging
+func (m MultiIndex[V]) Dump(w io.Writer) error {
+	for i, cont := range m.MultiIndexBy {
+		if _, err := fmt.Fprintf(w, "index %s (%T): %d elements\n", m.IndexName(i), cont, cont.Size()); err != nil {
+			return err
+		}
+		var err error
+		cont.TraversalValue(func(v V) bool {
+			_, err = fmt.Fprintf(w, "\t%+v\n", v)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -91,32 +333,47 @@ func (m MultiIndex[V]) Verify() (err error) {
 
 	allValues := make(map[V]int)
 
+	p := m.primary()
+	m.MultiIndexBy[p].TraversalValue(func(v V) bool {
+		_, ok := allValues[v]
+		if ok {
+			panic(fmt.Errorf("duplicate at %s: '%+v'", m.IndexName(p), v))
+		}
+		allValues[v] = 1
+		return true
+	})
+
 	for i, cont := range m.MultiIndexBy {
-		if i == 0 {
-			cont.TraversalValue(func(v V) bool {
-				_, ok := allValues[v]
-				if ok {
-					panic(fmt.Errorf("duplicate at %d: '%+v'", i, v))
+		if i == p {
+			continue
+		}
+		expected := len(allValues)
+		partial, isPartial := cont.(Partial[V])
+		if isPartial {
+			expected = 0
+			for v := range allValues {
+				if partial.Accepts(v) {
+					expected += 1
 				}
-				allValues[v] = 1
-				return true
-			})
-		} else {
-			if len(allValues) != cont.Size() {
-				panic(fmt.Errorf("wrong reported size at %d: %d != %d", i, len(allValues), cont.Size()))
 			}
-			cnt := 0
-			cont.TraversalValue(func(v V) bool {
-				_, ok := allValues[v]
-				if !ok {
-					panic(fmt.Errorf("exists only at %d: '%+v'", i, v))
-				}
-				cnt += 1
-				return true
-			})
-			if len(allValues) != cont.Size() {
-				panic(fmt.Errorf("wrong real size at %d: %d != %d", i, len(allValues), cont.Size()))
+		}
+		if expected != cont.Size() {
+			panic(fmt.Errorf("wrong reported size at %s: %d != %d", m.IndexName(i), expected, cont.Size()))
+		}
+		cnt := 0
+		cont.TraversalValue(func(v V) bool {
+			_, ok := allValues[v]
+			if !ok {
+				panic(fmt.Errorf("exists only at %s: '%+v'", m.IndexName(i), v))
+			}
+			if isPartial && !partial.Accepts(v) {
+				panic(fmt.Errorf("filtered out but exists at %s: '%+v'", m.IndexName(i), v))
 			}
+			cnt += 1
+			return true
+		})
+		if expected != cnt {
+			panic(fmt.Errorf("wrong real size at %s: %d != %d", m.IndexName(i), expected, cnt))
 		}
 	}
 
@@ -0,0 +1,159 @@
+package multiindex_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type Order struct {
+	ID     int
+	Status string
+	Region string
+}
+
+func TestBitmap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+
+	a, b := &multiindex_container.Bitmap{}, &multiindex_container.Bitmap{}
+	sa, sb := make(map[uint32]bool), make(map[uint32]bool)
+	for i := 0; i < 20000; i++ {
+		// dense around 0, sparse above
+		x := uint32(rnd.Intn(10000))
+		if i%2 == 0 {
+			x = uint32(rnd.Intn(1 << 20))
+		}
+		a.Add(x)
+		sa[x] = true
+		y := uint32(rnd.Intn(10000))
+		b.Add(y)
+		sb[y] = true
+	}
+	for x := range sa {
+		if rnd.Intn(3) == 0 {
+			a.Remove(x)
+			delete(sa, x)
+		}
+	}
+
+	check := func(name string, bm *multiindex_container.Bitmap, expected func(x uint32) bool) {
+		cnt := 0
+		prev := int64(-1)
+		for x := range bm.Values() {
+			if int64(x) <= prev {
+				t.Errorf("%s: not sorted", name)
+			}
+			prev = int64(x)
+			if !expected(x) {
+				t.Errorf("%s: unexpected %d", name, x)
+			}
+			cnt++
+		}
+		if cnt != bm.Cardinality() {
+			t.Errorf("%s: cardinality %d != %d", name, bm.Cardinality(), cnt)
+		}
+	}
+	and, or, andNot := a.And(b), a.Or(b), a.AndNot(b)
+	check("and", and, func(x uint32) bool { return sa[x] && sb[x] })
+	check("or", or, func(x uint32) bool { return sa[x] || sb[x] })
+	check("andNot", andNot, func(x uint32) bool { return sa[x] && !sb[x] })
+	if and.Cardinality()+andNot.Cardinality() != len(sa) {
+		t.Errorf("and + andNot != a")
+	}
+	if or.Cardinality() != len(sa)+len(sb)-and.Cardinality() {
+		t.Errorf("or != a + b - and")
+	}
+}
+
+func TestBitmapBoundary(t *testing.T) {
+	bm := &multiindex_container.Bitmap{}
+	for x := uint32(0); x <= 4096; x++ {
+		bm.Add(x)
+	}
+	// a chunk hovering around the array limit must not convert back and forth
+	allocs := testing.AllocsPerRun(100, func() {
+		bm.Remove(4096)
+		bm.Add(4096)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per remove and add at the limit", allocs)
+	}
+
+	for x := uint32(4096); x >= 100; x-- {
+		bm.Remove(x)
+	}
+	if bm.Cardinality() != 100 {
+		t.Errorf("cardinality %d != 100", bm.Cardinality())
+	}
+	for x := uint32(0); x < 200; x++ {
+		if bm.Contains(x) != (x < 100) {
+			t.Errorf("contains %d: %v", x, bm.Contains(x))
+		}
+	}
+}
+
+func TestBitmapIndex(t *testing.T) {
+	m := multiindex.New[Order]()
+	rows := multiindex_container.NewRowIDs[Order]()
+	byID := multiindex_container.NewNonOrderedUnique(func(o Order) int { return o.ID })
+	byStatus := multiindex_container.NewBitmapIndex(rows, func(o Order) string { return o.Status })
+	byRegion := multiindex_container.NewBitmapIndex(rows, func(o Order) string { return o.Region })
+	m.AddIndex(byID, byStatus, byRegion)
+
+	statuses := []string{"open", "closed", "cancelled"}
+	regions := []string{"eu", "us", "apac", "latam"}
+	orders := make(map[int]Order)
+	for i := 0; i < 1200; i++ {
+		o := Order{ID: i, Status: statuses[i%3], Region: regions[i%4]}
+		m.Insert(o)
+		orders[i] = o
+	}
+	for i := 0; i < 1200; i += 5 {
+		m.Erase(orders[i])
+		delete(orders, i)
+	}
+	if err := m.Verify(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	openEU := 0
+	notOpenOrUS := 0
+	for _, o := range orders {
+		if o.Status == "open" && o.Region == "eu" {
+			openEU++
+		}
+		if o.Status != "open" || o.Region == "us" {
+			notOpenOrUS++
+		}
+	}
+
+	res := byStatus.Get("open").And(byRegion.Get("eu"))
+	cnt := 0
+	for o := range rows.Values(res) {
+		if o.Status != "open" || o.Region != "eu" {
+			t.Errorf("unexpected %v", o)
+		}
+		cnt++
+	}
+	if cnt != openEU {
+		t.Errorf("open & eu: %d != %d", cnt, openEU)
+	}
+
+	res = rows.Not(byStatus.Get("open")).Or(byRegion.Get("us"))
+	if res.Cardinality() != notOpenOrUS {
+		t.Errorf("!open | us: %d != %d", res.Cardinality(), notOpenOrUS)
+	}
+
+	closed := 0
+	for o := range byStatus.Where("closed") {
+		if o.Status != "closed" {
+			t.Errorf("unexpected %v", o)
+		}
+		closed++
+	}
+	if closed != byStatus.Get("closed").Cardinality() {
+		t.Errorf("closed: %d != %d", closed, byStatus.Get("closed").Cardinality())
+	}
+}
@@ -0,0 +1,169 @@
+package multiindex_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+)
+
+func TestChangefeed(t *testing.T) {
+	m, byISBN := newDurableIndex()
+	for i := 0; i < 3; i++ {
+		m.Insert(Book{Name: fmt.Sprint(i), ISBN: fmt.Sprintf("%03d", i)})
+	}
+	feed := multiindex.NewChangefeed(m, 4)
+	defer feed.Close()
+
+	follower, followerISBN := newDurableIndex()
+	applier := multiindex.NewApplier(follower, 0)
+	ch := make(chan multiindex.Record[Book], 100)
+	drain := func() {
+		t.Helper()
+		for len(ch) > 0 {
+			if err := applier.Apply(<-ch); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// a new follower gets a dump
+	sub := feed.Follow(0, multiindex.ChanSink(ch))
+	if len(ch) != 4 {
+		t.Fatalf("dump of %d records", len(ch))
+	}
+	drain()
+	if followerISBN.Size() != 3 {
+		t.Fatalf("follower has %d elements", followerISBN.Size())
+	}
+
+	b := Book{Name: "3", ISBN: "003"}
+	m.Insert(b)
+	b2 := b
+	b2.Author = "Verne"
+	m.Modify(b, b2)
+	m.Erase(Book{Name: "0", ISBN: "000"})
+	drain()
+	if feed.Seq() != 3 || applier.Seq() != 3 {
+		t.Fatalf("seq %d, applied %d", feed.Seq(), applier.Seq())
+	}
+	if got, want := durableContent(followerISBN), []Book{{Name: "1", ISBN: "001"}, {Name: "2", ISBN: "002"}, b2}; !slices.Equal(got, want) {
+		t.Fatalf("follower: %v, want %v", got, want)
+	}
+
+	// resume from the backlog
+	sub.Stop()
+	m.Insert(Book{Name: "4", ISBN: "004"})
+	m.Insert(Book{Name: "5", ISBN: "005"})
+	if len(ch) != 0 {
+		t.Fatal("stopped subscription received records")
+	}
+	sub = feed.Follow(applier.Seq(), multiindex.ChanSink(ch))
+	if len(ch) != 2 {
+		t.Fatalf("resumed with %d records", len(ch))
+	}
+	drain()
+
+	// already applied records are skipped
+	if err := applier.Apply(multiindex.Record[Book]{Seq: 4, Kind: multiindex.RecordChange, Change: multiindex.Change[Book]{Op: multiindex.OpInsert, New: Book{ISBN: "004"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// too far behind: dumped again
+	sub.Stop()
+	for i := 6; i < 12; i++ {
+		m.Insert(Book{Name: fmt.Sprint(i), ISBN: fmt.Sprintf("%03d", i)})
+	}
+	feed.Follow(applier.Seq(), multiindex.ChanSink(ch))
+	if r := <-ch; r.Kind != multiindex.RecordReset || r.Seq != feed.Seq() {
+		t.Fatalf("got %+v, want a reset", r)
+	}
+	if err := applier.Apply(multiindex.Record[Book]{Seq: feed.Seq(), Kind: multiindex.RecordReset}); err != nil {
+		t.Fatal(err)
+	}
+	drain()
+	if got, want := durableContent(followerISBN), durableContent(byISBN); !slices.Equal(got, want) {
+		t.Fatalf("follower: %v, want %v", got, want)
+	}
+
+	// gaps are detected
+	err := applier.Apply(multiindex.Record[Book]{Seq: feed.Seq() + 2, Kind: multiindex.RecordChange, Change: multiindex.Change[Book]{Op: multiindex.OpInsert, New: Book{ISBN: "100"}}})
+	if !errors.Is(err, multiindex.ErrGap) {
+		t.Fatalf("got %v, want ErrGap", err)
+	}
+}
+
+func TestChangefeedWriter(t *testing.T) {
+	m, byISBN := newDurableIndex()
+	m.Insert(Book{Name: "a", ISBN: "001"})
+	feed := multiindex.NewChangefeed(m, 0)
+	defer feed.Close()
+
+	var buf bytes.Buffer
+	feed.Follow(0, multiindex.WriterSink(&buf, multiindex.JSONCodec[Book]{}))
+	m.Insert(Book{Name: "b", ISBN: "002"})
+	m.Modify(Book{Name: "a", ISBN: "001"}, Book{Name: "a", Author: "Verne", ISBN: "001"})
+
+	follower, followerISBN := newDurableIndex()
+	follower.Insert(Book{Name: "stale", ISBN: "999"})
+	applier := multiindex.NewApplier(follower, 0)
+	if err := applier.Consume(&buf, multiindex.JSONCodec[Book]{}); err != nil {
+		t.Fatal(err)
+	}
+	if applier.Seq() != 2 {
+		t.Fatalf("applied up to %d", applier.Seq())
+	}
+	if got, want := durableContent(followerISBN), durableContent(byISBN); !slices.Equal(got, want) {
+		t.Fatalf("follower: %v, want %v", got, want)
+	}
+}
+
+func TestChangefeedConsumeCorrupt(t *testing.T) {
+	follower, _ := newDurableIndex()
+	applier := multiindex.NewApplier(follower, 0)
+	// a record claiming an exabyte
+	stream := binary.AppendUvarint(nil, 1<<60)
+	stream = append(stream, "short"...)
+	if err := applier.Consume(bytes.NewReader(stream), multiindex.JSONCodec[Book]{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestChangefeedResetRestricted(t *testing.T) {
+	l := newLibrary(t, multiindex.Restrict)
+	applier := multiindex.NewApplier(l.authors, 0)
+	// Verne has books: the follower cannot be cleared for the dump
+	err := applier.Apply(multiindex.Record[Author]{Seq: 1, Kind: multiindex.RecordReset})
+	var ce *multiindex.ConstraintError
+	if !errors.As(err, &ce) {
+		t.Fatalf("got %v, want *ConstraintError", err)
+	}
+	if applier.Seq() != 0 {
+		t.Fatalf("applied up to %d", applier.Seq())
+	}
+}
+
+func TestChangefeedBacklog(t *testing.T) {
+	m, _ := newDurableIndex()
+	feed := multiindex.NewChangefeed(m, 3)
+	defer feed.Close()
+	for i := 0; i < 10; i++ {
+		m.Insert(Book{ISBN: fmt.Sprintf("%03d", i)})
+		ch := make(chan multiindex.Record[Book], 10)
+		from := max(feed.Seq(), 3) - 3
+		feed.Follow(from, multiindex.ChanSink(ch)).Stop()
+		if from == 0 {
+			continue
+		}
+		for seq := from + 1; seq <= feed.Seq(); seq++ {
+			if r := <-ch; r.Kind != multiindex.RecordChange || r.Seq != seq {
+				t.Fatalf("after %d changes: got %+v, want change %d", feed.Seq(), r, seq)
+			}
+		}
+	}
+}
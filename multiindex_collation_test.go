@@ -0,0 +1,72 @@
+package multiindex_test
+
+import (
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+	"golang.org/x/text/language"
+)
+
+type User struct {
+	Email string
+	Name  string
+}
+
+func TestNormalization(t *testing.T) {
+	m := multiindex.New[User]()
+	byEmail := multiindex_container.NewNonOrderedUnique(
+		func(u User) string { return u.Email },
+		multiindex_container.WithNormalizer(multiindex_container.CaseFold),
+	)
+	byName := multiindex_container.NewOrderedNonUnique(
+		func(u User) string { return u.Name },
+		multiindex_container.WithNormalizer(multiindex_container.NFC),
+		multiindex_container.WithComparator(multiindex_container.Collation(language.German)),
+	)
+	m.AddIndex(byEmail, byName)
+
+	users := []User{
+		{Email: "zoe@x.com", Name: "Zoe"},
+		{Email: "aerger@x.com", Name: "A\u0308rger"}, // decomposed
+		{Email: "apfel@x.com", Name: "Apfel"},
+		{Email: "baer@x.com", Name: "Bär"},
+	}
+	for _, u := range users {
+		if !m.Insert(u) {
+			t.Errorf("not inserted: %v", u)
+		}
+	}
+	if m.Insert(User{Email: "ZOE@X.COM", Name: "Zoe 2"}) {
+		t.Errorf("case-insensitive duplicate inserted")
+	}
+	if it := byEmail.Find("Apfel@X.com"); !it.IsValid() || it.Value() != users[2] {
+		t.Errorf("Find: case folding is not applied")
+	}
+
+	var names []string
+	for k := range byName.All() {
+		names = append(names, k)
+	}
+	expected := []string{"Apfel", "\u00c4rger", "B\u00e4r", "Zoe"}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("collation order: %q", names)
+			break
+		}
+	}
+
+	// the composed form finds the decomposed one
+	testUsers := 0
+	for range byName.Where("\u00c4rger") {
+		testUsers++
+	}
+	if testUsers != 1 {
+		t.Errorf("Where: NFC is not applied")
+	}
+
+	m.Erase(users[1])
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package multiindex_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+func TestConstraints(t *testing.T) {
+	m := multiindex.New[Book]()
+	byISBN := multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN })
+	byAuthor := multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Author })
+	m.AddNamedIndex("isbn", byISBN)
+	m.AddNamedIndex("author", byAuthor)
+
+	if err := m.AddCheck("has isbn", func(b Book) bool { return b.ISBN != "" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddMaxPerKey("2 per author", byAuthor, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddCheck("has isbn", func(b Book) bool { return true }); err == nil {
+		t.Fatal("duplicate constraint name accepted")
+	}
+
+	var cerr *multiindex.ConstraintError
+	if err := m.TryInsert(Book{Name: "no isbn", Author: "Verne"}); !errors.As(err, &cerr) || cerr.Constraint != "has isbn" {
+		t.Fatalf("got %v, want a violation of has isbn", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.TryInsert(Book{Name: fmt.Sprint(i), Author: "Verne", ISBN: fmt.Sprintf("%03d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	third := Book{Name: "2", Author: "Verne", ISBN: "002"}
+	if err := m.TryInsert(third); !errors.As(err, &cerr) || cerr.Constraint != "2 per author" {
+		t.Fatalf("got %v, want a violation of 2 per author", err)
+	}
+	// rolled back from all indexes
+	if byISBN.Size() != 2 || byAuthor.Size() != 2 {
+		t.Fatalf("sizes %d, %d after a violation", byISBN.Size(), byAuthor.Size())
+	}
+	if err := m.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// modifying within the same key does not count twice
+	if !m.Modify(Book{Name: "0", Author: "Verne", ISBN: "000"}, Book{Name: "zero", Author: "Verne", ISBN: "000"}) {
+		t.Fatal("Modify within the limit failed")
+	}
+	if m.Modify(Book{Name: "1", Author: "Verne", ISBN: "001"}, Book{Name: "1", Author: "Verne"}) {
+		t.Fatal("Modify violating a check succeeded")
+	}
+	if !m.Contains(Book{Name: "1", Author: "Verne", ISBN: "001"}) {
+		t.Fatal("element lost by a rejected Modify")
+	}
+	if err := m.Apply(multiindex.Change[Book]{Op: multiindex.OpInsert, New: third}); !errors.As(err, &cerr) {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	m.RemoveConstraint("2 per author")
+	if !m.Insert(third) {
+		t.Fatal("Insert failed after RemoveConstraint")
+	}
+	if err := m.AddMaxPerKey("2 per author", byAuthor, 2); !errors.As(err, &cerr) {
+		t.Fatalf("constraint violated by present elements: %v", err)
+	}
+	other := multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Name })
+	if err := m.AddMaxPerKey("foreign", other, 1); err == nil {
+		t.Fatal("AddMaxPerKey on an index of another multiindex")
+	}
+}
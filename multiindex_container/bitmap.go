@@ -0,0 +1,309 @@
+package multiindex_container
+
+import (
+	"iter"
+	"math/bits"
+	"slices"
+)
+
+// chunks with at most this many members are stored as a sorted array, denser ones as a bitset
+const bitmapArrayMax = 4096
+
+// shrinking bitsets turn back into arrays only below this, so a chunk hovering around
+// bitmapArrayMax doesn't convert on every change
+const bitmapArrayMin = bitmapArrayMax - 1024
+
+type bitmapChunk struct {
+	array []uint16
+	words []uint64 // 1024 words when not nil
+	n     int
+}
+
+func (c *bitmapChunk) contains(lo uint16) bool {
+	if c.words != nil {
+		return c.words[lo>>6]&(1<<(lo&63)) != 0
+	}
+	_, found := slices.BinarySearch(c.array, lo)
+	return found
+}
+
+func (c *bitmapChunk) add(lo uint16) bool {
+	if c.words != nil {
+		w, b := lo>>6, uint64(1)<<(lo&63)
+		if c.words[w]&b != 0 {
+			return false
+		}
+		c.words[w] |= b
+		c.n++
+		return true
+	}
+	i, found := slices.BinarySearch(c.array, lo)
+	if found {
+		return false
+	}
+	c.array = slices.Insert(c.array, i, lo)
+	c.n++
+	if c.n > bitmapArrayMax {
+		c.toWords()
+	}
+	return true
+}
+
+func (c *bitmapChunk) remove(lo uint16) bool {
+	if c.words != nil {
+		w, b := lo>>6, uint64(1)<<(lo&63)
+		if c.words[w]&b == 0 {
+			return false
+		}
+		c.words[w] &^= b
+		c.n--
+		if c.n < bitmapArrayMin {
+			c.normalize()
+		}
+		return true
+	}
+	i, found := slices.BinarySearch(c.array, lo)
+	if !found {
+		return false
+	}
+	c.array = slices.Delete(c.array, i, i+1)
+	c.n--
+	return true
+}
+
+func (c *bitmapChunk) toWords() {
+	if c.words != nil {
+		return
+	}
+	c.words = make([]uint64, 1024)
+	for _, lo := range c.array {
+		c.words[lo>>6] |= 1 << (lo & 63)
+	}
+	c.array = nil
+}
+
+// normalize switches a sparse bitset back to the array form
+func (c *bitmapChunk) normalize() {
+	if c.words == nil || c.n > bitmapArrayMax {
+		return
+	}
+	array := make([]uint16, 0, c.n)
+	for lo := range c.values() {
+		array = append(array, lo)
+	}
+	c.array, c.words = array, nil
+}
+
+func (c *bitmapChunk) values() iter.Seq[uint16] {
+	return func(yield func(uint16) bool) {
+		if c.words == nil {
+			for _, lo := range c.array {
+				if !yield(lo) {
+					return
+				}
+			}
+			return
+		}
+		for w, word := range c.words {
+			for word != 0 {
+				b := bits.TrailingZeros64(word)
+				if !yield(uint16(w<<6 | b)) {
+					return
+				}
+				word &= word - 1
+			}
+		}
+	}
+}
+
+func (c *bitmapChunk) clone() bitmapChunk {
+	return bitmapChunk{
+		array: slices.Clone(c.array),
+		words: slices.Clone(c.words),
+		n:     c.n,
+	}
+}
+
+// combine applies a word-wise operation to two chunks; arrays are merged without expanding them
+func combineChunks(a, b *bitmapChunk, op func(x, y uint64) uint64) bitmapChunk {
+	if a.words == nil && b.words == nil {
+		res := bitmapChunk{}
+		for _, src := range [][]uint16{a.array, b.array} {
+			for _, lo := range src {
+				x, y := uint64(0), uint64(0)
+				if a.contains(lo) {
+					x = 1
+				}
+				if b.contains(lo) {
+					y = 1
+				}
+				if op(x, y)&1 != 0 {
+					res.array = append(res.array, lo)
+				}
+			}
+		}
+		slices.Sort(res.array)
+		res.array = slices.Compact(res.array)
+		res.n = len(res.array)
+		if res.n > bitmapArrayMax {
+			res.toWords()
+		}
+		return res
+	}
+
+	aw, bw := a.words, b.words
+	if aw == nil {
+		ac := a.clone()
+		ac.toWords()
+		aw = ac.words
+	}
+	if bw == nil {
+		bc := b.clone()
+		bc.toWords()
+		bw = bc.words
+	}
+	res := bitmapChunk{words: make([]uint64, 1024)}
+	for i := range res.words {
+		res.words[i] = op(aw[i], bw[i])
+		res.n += bits.OnesCount64(res.words[i])
+	}
+	res.normalize()
+	return res
+}
+
+// Bitmap is a compressed set of row IDs: IDs are grouped by their upper 16 bits,
+// and every group is either a sorted array or a 65536-bit bitset, whichever is smaller
+// (a bitset shrunk by Remove stays one until it drops well below the array limit).
+// Bitmaps returned by an index must not be modified; And, Or and AndNot always return new bitmaps.
+type Bitmap struct {
+	keys   []uint16
+	chunks []bitmapChunk
+}
+
+func (b *Bitmap) chunk(hi uint16) *bitmapChunk {
+	i, found := slices.BinarySearch(b.keys, hi)
+	if !found {
+		return nil
+	}
+	return &b.chunks[i]
+}
+
+func (b *Bitmap) Add(x uint32) bool {
+	hi, lo := uint16(x>>16), uint16(x)
+	i, found := slices.BinarySearch(b.keys, hi)
+	if !found {
+		b.keys = slices.Insert(b.keys, i, hi)
+		b.chunks = slices.Insert(b.chunks, i, bitmapChunk{})
+	}
+	return b.chunks[i].add(lo)
+}
+
+func (b *Bitmap) Remove(x uint32) bool {
+	hi, lo := uint16(x>>16), uint16(x)
+	i, found := slices.BinarySearch(b.keys, hi)
+	if !found || !b.chunks[i].remove(lo) {
+		return false
+	}
+	if b.chunks[i].n == 0 {
+		b.keys = slices.Delete(b.keys, i, i+1)
+		b.chunks = slices.Delete(b.chunks, i, i+1)
+	}
+	return true
+}
+
+func (b *Bitmap) Contains(x uint32) bool {
+	if b == nil {
+		return false
+	}
+	c := b.chunk(uint16(x >> 16))
+	return c != nil && c.contains(uint16(x))
+}
+
+func (b *Bitmap) Cardinality() int {
+	if b == nil {
+		return 0
+	}
+	n := 0
+	for i := range b.chunks {
+		n += b.chunks[i].n
+	}
+	return n
+}
+
+func (b *Bitmap) Clone() *Bitmap {
+	res := &Bitmap{}
+	if b == nil {
+		return res
+	}
+	res.keys = slices.Clone(b.keys)
+	res.chunks = make([]bitmapChunk, len(b.chunks))
+	for i := range b.chunks {
+		res.chunks[i] = b.chunks[i].clone()
+	}
+	return res
+}
+
+// Values yields the members in ascending order
+func (b *Bitmap) Values() iter.Seq[uint32] {
+	return func(yield func(uint32) bool) {
+		if b == nil {
+			return
+		}
+		for i, hi := range b.keys {
+			for lo := range b.chunks[i].values() {
+				if !yield(uint32(hi)<<16 | uint32(lo)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *Bitmap) And(o *Bitmap) *Bitmap {
+	return b.combine(o, func(x, y uint64) uint64 { return x & y }, false, false)
+}
+
+func (b *Bitmap) Or(o *Bitmap) *Bitmap {
+	return b.combine(o, func(x, y uint64) uint64 { return x | y }, true, true)
+}
+
+func (b *Bitmap) AndNot(o *Bitmap) *Bitmap {
+	return b.combine(o, func(x, y uint64) uint64 { return x &^ y }, true, false)
+}
+
+// combine applies `op` chunk by chunk; keepOwn/keepOther tell whether a chunk present on one side only survives
+func (b *Bitmap) combine(o *Bitmap, op func(x, y uint64) uint64, keepOwn, keepOther bool) *Bitmap {
+	if b == nil {
+		b = &Bitmap{}
+	}
+	if o == nil {
+		o = &Bitmap{}
+	}
+	res := &Bitmap{}
+	i, j := 0, 0
+	for i < len(b.keys) || j < len(o.keys) {
+		switch {
+		case j == len(o.keys) || (i < len(b.keys) && b.keys[i] < o.keys[j]):
+			if keepOwn {
+				res.keys = append(res.keys, b.keys[i])
+				res.chunks = append(res.chunks, b.chunks[i].clone())
+			}
+			i++
+		case i == len(b.keys) || o.keys[j] < b.keys[i]:
+			if keepOther {
+				res.keys = append(res.keys, o.keys[j])
+				res.chunks = append(res.chunks, o.chunks[j].clone())
+			}
+			j++
+		default:
+			c := combineChunks(&b.chunks[i], &o.chunks[j], op)
+			if c.n > 0 {
+				res.keys = append(res.keys, b.keys[i])
+				res.chunks = append(res.chunks, c)
+			}
+			i++
+			j++
+		}
+	}
+	return res
+}
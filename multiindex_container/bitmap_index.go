@@ -0,0 +1,279 @@
+package multiindex_container
+
+import (
+	"iter"
+	"reflect"
+
+	"github.com/agmt/go-multiindex"
+)
+
+type rowRef struct {
+	id   uint32
+	refs int
+}
+
+// RowIDs assigns dense row IDs to elements. Bitmap indexes which share one RowIDs
+// can be combined with Bitmap.And/Or/AndNot and RowIDs.Not.
+type RowIDs[V comparable] struct {
+	ids   map[V]*rowRef
+	rows  []V
+	alive Bitmap
+	free  []uint32
+}
+
+func NewRowIDs[V comparable]() *RowIDs[V] {
+	return &RowIDs[V]{
+		ids: make(map[V]*rowRef),
+	}
+}
+
+func (r *RowIDs[V]) acquire(v V) uint32 {
+	ref := r.ids[v]
+	if ref == nil {
+		ref = &rowRef{}
+		if n := len(r.free); n > 0 {
+			ref.id = r.free[n-1]
+			r.free = r.free[:n-1]
+			r.rows[ref.id] = v
+		} else {
+			ref.id = uint32(len(r.rows))
+			r.rows = append(r.rows, v)
+		}
+		r.ids[v] = ref
+		r.alive.Add(ref.id)
+	}
+	ref.refs++
+	return ref.id
+}
+
+func (r *RowIDs[V]) release(v V) {
+	ref := r.ids[v]
+	if ref == nil {
+		return
+	}
+	ref.refs--
+	if ref.refs > 0 {
+		return
+	}
+	delete(r.ids, v)
+	r.alive.Remove(ref.id)
+	var zero V
+	r.rows[ref.id] = zero
+	r.free = append(r.free, ref.id)
+}
+
+func (r *RowIDs[V]) ID(v V) (uint32, bool) {
+	ref := r.ids[v]
+	if ref == nil {
+		return 0, false
+	}
+	return ref.id, true
+}
+
+func (r *RowIDs[V]) Value(id uint32) V {
+	return r.rows[id]
+}
+
+// All returns the IDs of all elements indexed by any bitmap index sharing `r`
+func (r *RowIDs[V]) All() *Bitmap {
+	return &r.alive
+}
+
+// Not returns the complement of `b` among the elements known to `r`
+func (r *RowIDs[V]) Not(b *Bitmap) *Bitmap {
+	return r.alive.AndNot(b)
+}
+
+// Values yields the elements behind the row IDs of `b`
+func (r *RowIDs[V]) Values(b *Bitmap) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for id := range b.Values() {
+			if !yield(r.rows[id]) {
+				return
+			}
+		}
+	}
+}
+
+// MultiIndexByBitmap is a non-unique index keeping a compressed bitmap of row IDs per key.
+// It suits low-cardinality keys (status, region, ...).
+type MultiIndexByBitmap[K comparable, V comparable] struct {
+	Rows      *RowIDs[V]
+	Container map[K]*Bitmap
+	GetIndex  func(v V) K
+	Normalize func(k K) K
+	encoding  keyEncoding[K]
+	size      int
+	onAccess  func(v V)
+}
+
+// NewBitmapIndex creates a bitmap index; pass the same `rows` to indexes which will be combined.
+// nil `rows` allocates private row IDs.
+func NewBitmapIndex[K comparable, V comparable](
+	rows *RowIDs[V],
+	getIndex func(v V) K,
+	opts ...Option[K],
+) *MultiIndexByBitmap[K, V] {
+	if rows == nil {
+		rows = NewRowIDs[V]()
+	}
+	o := newOptions(opts)
+	mib := &MultiIndexByBitmap[K, V]{
+		Rows:      rows,
+		Container: make(map[K]*Bitmap),
+		GetIndex:  normalizedGetIndex(o, getIndex),
+		Normalize: o.normalize,
+		encoding:  o.encoding,
+	}
+	return mib
+}
+
+func (t *MultiIndexByBitmap[K, V]) Insert(v V) multiindex.ConstIterator[V] {
+	key := t.GetIndex(v)
+	bm := t.Container[key]
+	if bm == nil {
+		bm = &Bitmap{}
+		t.Container[key] = bm
+	}
+	id := t.Rows.acquire(v)
+	if bm.Add(id) {
+		t.size++
+	} else {
+		t.Rows.release(v)
+	}
+	return NewMapNonUniqueIterator(v)
+}
+
+func (t *MultiIndexByBitmap[K, V]) Find(key K) (iter multiindex.ConstIterator[V]) {
+	for id := range t.Container[normalizeKey(t.Normalize, key)].Values() {
+		v := t.Rows.Value(id)
+		if t.onAccess != nil {
+			t.onAccess(v)
+		}
+		return NewMapNonUniqueIterator(v)
+	}
+	return
+}
+
+func (t *MultiIndexByBitmap[K, V]) FindValue(v V) (iter multiindex.ConstIterator[V]) {
+	id, ok := t.Rows.ID(v)
+	if !ok || !t.Container[t.GetIndex(v)].Contains(id) {
+		return
+	}
+	return NewMapNonUniqueIterator(v)
+}
+
+func (t *MultiIndexByBitmap[K, V]) Erase_Internal(it multiindex.ConstIterator[V]) {
+	iter, ok := it.(MapNonUniqueIterator[V])
+	if !ok {
+		panic("wrong iterator")
+	}
+	key := t.GetIndex(iter.ptr)
+	bm := t.Container[key]
+	id, ok := t.Rows.ID(iter.ptr)
+	if bm == nil || !ok || !bm.Remove(id) {
+		return
+	}
+	t.Rows.release(iter.ptr)
+	t.size--
+	if bm.Cardinality() == 0 {
+		delete(t.Container, key)
+	}
+}
+
+func (t *MultiIndexByBitmap[K, V]) ObserveAccess(onAccess func(v V)) {
+	t.onAccess = onAccess
+}
+
+func (t *MultiIndexByBitmap[K, V]) Size() int {
+	return t.size
+}
+
+// Get returns the row IDs of elements with key `k`; the result must not be modified
+func (t *MultiIndexByBitmap[K, V]) Get(k K) *Bitmap {
+	bm := t.Container[normalizeKey(t.Normalize, k)]
+	if bm == nil {
+		return &Bitmap{}
+	}
+	return bm
+}
+
+func (t *MultiIndexByBitmap[K, V]) TraversalKV(visitor func(k K, v V) bool) {
+	for k, bm := range t.Container {
+		for id := range bm.Values() {
+			if !visitor(k, t.Rows.Value(id)) {
+				return
+			}
+		}
+	}
+}
+
+func (t *MultiIndexByBitmap[K, V]) TraversalValue(visitor func(v V) bool) {
+	t.TraversalKV(func(_ K, v V) bool {
+		return visitor(v)
+	})
+}
+
+func (t *MultiIndexByBitmap[K, V]) TraversalWithKey(k K, visitor func(v V) bool) {
+	for v := range t.Rows.Values(t.Container[normalizeKey(t.Normalize, k)]) {
+		if !visitor(v) {
+			return
+		}
+	}
+}
+
+func (t *MultiIndexByBitmap[K, V]) All() iter.Seq2[K, V] {
+	return t.TraversalKV
+}
+
+// Where yields the elements with key `k`, each counting as an access (see multiindex.AccessObserver)
+func (t *MultiIndexByBitmap[K, V]) Where(k K) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		t.TraversalWithKey(k, func(v V) bool {
+			if t.onAccess != nil {
+				t.onAccess(v)
+			}
+			return yield(v)
+		})
+	}
+}
+
+func (t *MultiIndexByBitmap[K, V]) Describe() multiindex.IndexInfo {
+	return multiindex.IndexInfo{
+		Kind:         "bitmap",
+		KeyType:      t.encoding.queryKeyType().String(),
+		DistinctKeys: len(t.Container),
+	}
+}
+
+func (t *MultiIndexByBitmap[K, V]) Stats() (size, distinct int) {
+	return t.size, len(t.Container)
+}
+
+func (t *MultiIndexByBitmap[K, V]) KeyType() reflect.Type {
+	return t.encoding.queryKeyType()
+}
+
+func (t *MultiIndexByBitmap[K, V]) Seek(p multiindex.Predicate) (iter.Seq[V], error) {
+	k, err := pointKey(p, t.Normalize, t.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(V) bool) {
+		for id := range t.Container[k].Values() {
+			if !yield(t.Rows.Value(id)) {
+				return
+			}
+		}
+	}, nil
+}
+
+func (t *MultiIndexByBitmap[K, V]) Matcher(p multiindex.Predicate) (func(v V) bool, error) {
+	k, err := pointKey(p, t.Normalize, t.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(v V) bool {
+		return t.GetIndex(v) == k
+	}, nil
+}
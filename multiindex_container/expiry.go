@@ -0,0 +1,58 @@
+package multiindex_container
+
+import (
+	"iter"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+)
+
+// MultiIndexByExpiry orders elements by their expiration time; use it with MultiIndex.ExpireBefore
+type MultiIndexByExpiry[V comparable] struct {
+	MultiIndexByOrderedNonUnique[time.Time, V]
+	GetExpiry func(v V) time.Time
+}
+
+func NewExpiry[V comparable](
+	getExpiry func(v V) time.Time,
+) *MultiIndexByExpiry[V] {
+	mib := &MultiIndexByExpiry[V]{
+		MultiIndexByOrderedNonUnique: newOrderedNonUnique(getExpiry, time.Time.Compare, nil),
+		GetExpiry:                    getExpiry,
+	}
+	return mib
+}
+
+// Before yields elements expiring strictly before `t`, soonest first
+func (t *MultiIndexByExpiry[V]) Before(deadline time.Time) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for node := t.Container.First(); node != nil && node.Key().Before(deadline); node = node.Next() {
+			if !yield(node.Value()) {
+				return
+			}
+		}
+	}
+}
+
+func (t *MultiIndexByExpiry[V]) ExpiredBefore(deadline time.Time) []V {
+	var res []V
+	for v := range t.Before(deadline) {
+		res = append(res, v)
+	}
+	return res
+}
+
+// NextExpiry returns the earliest expiration time
+func (t *MultiIndexByExpiry[V]) NextExpiry() (time.Time, bool) {
+	node := t.Container.First()
+	if node == nil {
+		return time.Time{}, false
+	}
+	return t.GetExpiry(node.Value()), true
+}
+
+func (t *MultiIndexByExpiry[V]) Describe() multiindex.IndexInfo {
+	info := t.MultiIndexByOrderedNonUnique.Describe()
+	info.Kind = "expiry"
+	return info
+}
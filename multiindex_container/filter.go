@@ -0,0 +1,96 @@
+package multiindex_container
+
+import (
+	"reflect"
+
+	"github.com/agmt/go-multiindex"
+)
+
+// MultiIndexByFilter is a partial index: only elements matching `Pred` are stored in `Index`.
+// Lookups go through `Index` directly.
+type MultiIndexByFilter[V comparable, I multiindex.MultiIndexByI[V]] struct {
+	Index I
+	Pred  func(v V) bool
+}
+
+// Filter wraps `index` so that it only holds elements matching `pred`, e.g.
+//
+//	byOpen := NewOrderedUnique(func(o Order) int { return o.ID })
+//	m.AddIndex(Filter(byOpen, func(o Order) bool { return o.Status == "open" }))
+func Filter[V comparable, I multiindex.MultiIndexByI[V]](
+	index I,
+	pred func(v V) bool,
+) *MultiIndexByFilter[V, I] {
+	mib := &MultiIndexByFilter[V, I]{
+		Index: index,
+		Pred:  pred,
+	}
+	return mib
+}
+
+func (t *MultiIndexByFilter[V, I]) Accepts(v V) bool {
+	return t.Pred(v)
+}
+
+// Insert skips elements not matching the predicate, which is not a failure
+func (t *MultiIndexByFilter[V, I]) Insert(v V) multiindex.ConstIterator[V] {
+	if !t.Pred(v) {
+		return NewMapNonUniqueIterator(v)
+	}
+	return t.Index.Insert(v)
+}
+
+func (t *MultiIndexByFilter[V, I]) FindValue(v V) (iter multiindex.ConstIterator[V]) {
+	if !t.Pred(v) {
+		return
+	}
+	return t.Index.FindValue(v)
+}
+
+func (t *MultiIndexByFilter[V, I]) Erase_Internal(it multiindex.ConstIterator[V]) {
+	t.Index.Erase_Internal(it)
+}
+
+func (t *MultiIndexByFilter[V, I]) ObserveAccess(onAccess func(v V)) {
+	if o, ok := any(t.Index).(multiindex.AccessObserver[V]); ok {
+		o.ObserveAccess(onAccess)
+	}
+}
+
+func (t *MultiIndexByFilter[V, I]) Size() int {
+	return t.Index.Size()
+}
+
+func (t *MultiIndexByFilter[V, I]) TraversalValue(visitor func(v V) bool) {
+	t.Index.TraversalValue(visitor)
+}
+
+// BulkLoad loads the elements matching the predicate
+func (t *MultiIndexByFilter[V, I]) BulkLoad(vs []V) bool {
+	var accepted []V
+	for _, v := range vs {
+		if t.Pred(v) {
+			accepted = append(accepted, v)
+		}
+	}
+	if b, ok := any(t.Index).(multiindex.BulkLoader[V]); ok {
+		return b.BulkLoad(accepted)
+	}
+	for i, v := range accepted {
+		if it := t.Index.Insert(v); it == nil || !it.IsValid() {
+			for _, w := range accepted[:i] {
+				t.Index.Erase_Internal(t.Index.FindValue(w))
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// Describe reports the wrapped index; MultiIndex.Schema marks it as partial
+func (t *MultiIndexByFilter[V, I]) Describe() multiindex.IndexInfo {
+	if d, ok := any(t.Index).(multiindex.Describer); ok {
+		return d.Describe()
+	}
+	return multiindex.IndexInfo{Kind: reflect.TypeOf(t.Index).String(), DistinctKeys: -1}
+}
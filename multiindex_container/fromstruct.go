@@ -0,0 +1,327 @@
+package multiindex_container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+)
+
+// Indexes is the registry of named indexes built by FromStruct.
+// All of them are keyed by EncodeKey(fields...) strings.
+type Indexes[V comparable] struct {
+	names  []string
+	byName map[string]multiindex.MultiIndexByI[V]
+	fields map[string][]reflect.Type // the key field types of every index
+}
+
+type stringKeyed[V comparable] interface {
+	Find(key string) multiindex.ConstIterator[V]
+	Where(key string) iter.Seq[V]
+}
+
+func (r *Indexes[V]) Names() []string {
+	return r.names
+}
+
+// Index returns the container registered as `name`, or nil
+func (r *Indexes[V]) Index(name string) multiindex.MultiIndexByI[V] {
+	return r.byName[name]
+}
+
+// EncodeKey encodes key fields of index `name`, in declaration order, as its keys are.
+// Numbers are converted to the type of their field, e.g. 3 matches a float64 field holding 3.
+func (r *Indexes[V]) EncodeKey(name string, key ...any) (string, error) {
+	types, ok := r.fields[name]
+	if !ok {
+		return "", fmt.Errorf("multiindex: unknown index %s", name)
+	}
+	return encodeFields(types, key)
+}
+
+func encodeFields(types []reflect.Type, key []any) (string, error) {
+	if len(key) > len(types) {
+		return "", fmt.Errorf("multiindex: %d key fields, got %d", len(types), len(key))
+	}
+	var enc []byte
+	for i, k := range key {
+		v := reflect.ValueOf(k)
+		// integers of any size and signedness share an encoding; only floats differ
+		if fk := types[i].Kind(); v.IsValid() && isNumber(v.Kind()) && (fk == reflect.Float32 || fk == reflect.Float64) {
+			v = v.Convert(reflect.TypeFor[float64]())
+		}
+		var err error
+		if enc, err = appendKey(enc, v); err != nil {
+			return "", err
+		}
+	}
+	return string(enc), nil
+}
+
+// structEncoding lets a multiindex.Query (and ParseQuery) use field values as keys of a
+// single-field index; composite keys cannot be queried this way
+func structEncoding(idx *structIndex) keyEncoding[string] {
+	if len(idx.types) > 1 {
+		return keyEncoding[string]{
+			encode: func(k any) (string, error) {
+				return "", fmt.Errorf("%w: index %s has a composite key, use Indexes.Where",
+					multiindex.ErrUnsupportedPredicate, idx.name)
+			},
+		}
+	}
+	return keyEncoding[string]{
+		encode: func(k any) (string, error) {
+			if v := reflect.ValueOf(k); v.IsValid() && v.Type() != idx.types[0] && !(isNumber(v.Kind()) && isNumber(idx.types[0].Kind())) {
+				return "", fmt.Errorf("key %v (%T) is not %v", k, k, idx.types[0])
+			}
+			return encodeFields(idx.types, []any{k})
+		},
+		keyType: idx.types[0],
+	}
+}
+
+// Find looks up an element by the key fields of index `name`, in declaration order
+func (r *Indexes[V]) Find(name string, key ...any) multiindex.ConstIterator[V] {
+	idx, ok := r.byName[name].(stringKeyed[V])
+	if !ok {
+		return nil
+	}
+	enc, err := r.EncodeKey(name, key...)
+	if err != nil {
+		return nil
+	}
+	return idx.Find(enc)
+}
+
+// Where yields the elements with the given key fields of index `name`, in declaration order
+func (r *Indexes[V]) Where(name string, key ...any) iter.Seq[V] {
+	idx, ok := r.byName[name].(stringKeyed[V])
+	enc, err := r.EncodeKey(name, key...)
+	if !ok || err != nil {
+		return func(yield func(V) bool) {}
+	}
+	return idx.Where(enc)
+}
+
+type structIndex struct {
+	name    string
+	unique  bool
+	ordered bool
+	fields  [][]int
+	types   []reflect.Type
+	flags   map[string]bool // options seen so far, to detect conflicts
+}
+
+// FromStruct builds a MultiIndex from `mi` struct tags of V (a struct or a pointer to one):
+//
+//	type Book struct {
+//		ISBN   string `mi:"isbn,unique,hashed"`
+//		Author string `mi:"author,ordered;author_name,unique"`
+//		Name   string `mi:"author_name"`
+//	}
+//
+// A tag lists `;`-separated index declarations: a name followed by options
+// (unique | nonunique, ordered | hashed; nonunique and hashed by default).
+// Fields sharing an index name form a composite key, in field order.
+// If V is a pointer, inserting nil fails with *multiindex.ConstraintError.
+func FromStruct[V comparable]() (*multiindex.MultiIndex[V], *Indexes[V], error) {
+	typ := reflect.TypeFor[V]()
+	ptr := typ.Kind() == reflect.Pointer
+	if ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("multiindex: FromStruct: %v is not a struct", typ)
+	}
+
+	var indexes []*structIndex
+	byName := make(map[string]*structIndex)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := field.Tag.Lookup("mi")
+		if !ok {
+			continue
+		}
+		if !field.IsExported() {
+			return nil, nil, fmt.Errorf("multiindex: FromStruct: field %s is not exported", field.Name)
+		}
+		if !encodable(field.Type) {
+			return nil, nil, fmt.Errorf("multiindex: FromStruct: field %s: unsupported key type %v", field.Name, field.Type)
+		}
+		for _, decl := range strings.Split(tag, ";") {
+			parts := strings.Split(decl, ",")
+			name := strings.TrimSpace(parts[0])
+			if name == "" {
+				return nil, nil, fmt.Errorf("multiindex: FromStruct: field %s: empty index name", field.Name)
+			}
+			idx := byName[name]
+			if idx == nil {
+				idx = &structIndex{name: name, flags: make(map[string]bool)}
+				byName[name] = idx
+				indexes = append(indexes, idx)
+			}
+			idx.fields = append(idx.fields, field.Index)
+			idx.types = append(idx.types, field.Type)
+			for _, opt := range parts[1:] {
+				opt = strings.TrimSpace(opt)
+				switch opt {
+				case "unique", "nonunique", "ordered", "hashed":
+				default:
+					return nil, nil, fmt.Errorf("multiindex: FromStruct: index %s: unknown option %q", name, opt)
+				}
+				idx.flags[opt] = true
+			}
+			if idx.flags["unique"] && idx.flags["nonunique"] || idx.flags["ordered"] && idx.flags["hashed"] {
+				return nil, nil, fmt.Errorf("multiindex: FromStruct: index %s: conflicting options", name)
+			}
+			idx.unique = idx.flags["unique"]
+			idx.ordered = idx.flags["ordered"]
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, nil, fmt.Errorf("multiindex: FromStruct: %v has no `mi` tags", typ)
+	}
+
+	m := multiindex.New[V]()
+	if ptr {
+		m.AddCheck("non-nil element", func(v V) bool { return !reflect.ValueOf(v).IsNil() })
+	}
+	r := &Indexes[V]{
+		byName: make(map[string]multiindex.MultiIndexByI[V]),
+		fields: make(map[string][]reflect.Type),
+	}
+	for _, idx := range indexes {
+		getIndex := structKey[V](ptr, idx.fields)
+		encoding := withKeyEncoding(structEncoding(idx))
+		var mib multiindex.MultiIndexByI[V]
+		switch {
+		case idx.ordered && idx.unique:
+			mib = NewOrderedUnique(getIndex, encoding)
+		case idx.ordered:
+			mib = NewOrderedNonUnique(getIndex, encoding)
+		case idx.unique:
+			mib = NewNonOrderedUnique(getIndex, encoding)
+		default:
+			mib = NewNonOrderedNonUnique(getIndex, encoding)
+		}
+		if err := m.AddNamedIndex(idx.name, mib); err != nil {
+			return nil, nil, err
+		}
+		r.names = append(r.names, idx.name)
+		r.byName[idx.name] = mib
+		r.fields[idx.name] = idx.types
+	}
+	return m, r, nil
+}
+
+func structKey[V comparable](ptr bool, fields [][]int) func(v V) string {
+	return func(v V) string {
+		rv := reflect.ValueOf(v)
+		if ptr {
+			if rv.IsNil() {
+				// no field has an empty key: a nil element, rejected by FromStruct, matches nothing
+				return ""
+			}
+			rv = rv.Elem()
+		}
+		var key []byte
+		for _, index := range fields {
+			// cannot fail: field types are checked by encodable
+			key, _ = appendKey(key, rv.FieldByIndex(index))
+		}
+		return string(key)
+	}
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func encodable(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isNumber(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// EncodeKey encodes values into a string whose byte order matches the order of the values,
+// compared field by field. Integers of any size and signedness compare as integers, floats as float64,
+// time.Time by its instant. Values of other types, including nil, are reported as an error.
+func EncodeKey(parts ...any) (string, error) {
+	var key []byte
+	for _, p := range parts {
+		var err error
+		if key, err = appendKey(key, reflect.ValueOf(p)); err != nil {
+			return "", err
+		}
+	}
+	return string(key), nil
+}
+
+func appendKey(dst []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return nil, errors.New("multiindex: nil key")
+	}
+	if v.Type() == timeType {
+		// seconds and nanoseconds apart: UnixNano overflows outside years 1678-2262
+		t := v.Interface().(time.Time)
+		dst = binary.BigEndian.AppendUint64(dst, uint64(t.Unix())^(1<<63))
+		return binary.BigEndian.AppendUint32(dst, uint32(t.Nanosecond())), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		// 0x00 is escaped so that the terminator sorts before any content
+		for _, b := range []byte(v.String()) {
+			if b == 0 {
+				dst = append(dst, 0, 0xff)
+			} else {
+				dst = append(dst, b)
+			}
+		}
+		return append(dst, 0, 1), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return append(dst, 1), nil
+		}
+		return append(dst, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// a sign byte, then the two's complement: shared with unsigned integers
+		if i := v.Int(); i < 0 {
+			return binary.BigEndian.AppendUint64(append(dst, 0), uint64(i)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(dst, 1), uint64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.BigEndian.AppendUint64(append(dst, 1), v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		// -0 equals +0, and all NaNs share one key, sorting after +Inf
+		f := v.Float()
+		if f == 0 {
+			f = 0
+		} else if math.IsNaN(f) {
+			f = math.NaN()
+		}
+		bits := math.Float64bits(f)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		return binary.BigEndian.AppendUint64(dst, bits), nil
+	}
+	return nil, fmt.Errorf("multiindex: unsupported key type %v", v.Type())
+}
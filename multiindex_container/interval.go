@@ -0,0 +1,175 @@
+package multiindex_container
+
+import (
+	"iter"
+
+	"github.com/agmt/go-multiindex"
+	rbtree "github.com/agmt/go-multiindex/gostl_rbtree"
+	"github.com/liyue201/gostl/utils/comparator"
+)
+
+type intervalItem[K comparator.Ordered, V comparable] struct {
+	hi    K
+	maxHi K // max `hi` in the subtree
+	value V
+}
+
+type intervalNode[K comparator.Ordered, V comparable] = rbtree.Node[K, *intervalItem[K, V]]
+
+// MultiIndexByInterval is a non-unique index of half-open ranges [lo, hi),
+// ordered by `lo` and augmented with the max `hi` of every subtree.
+type MultiIndexByInterval[K comparator.Ordered, V comparable] struct {
+	Container *rbtree.RbTree[K, *intervalItem[K, V]]
+	GetIndex  func(v V) (lo, hi K)
+}
+
+func NewInterval[K comparator.Ordered, V comparable](
+	getIndex func(v V) (lo, hi K),
+) *MultiIndexByInterval[K, V] {
+	mib := &MultiIndexByInterval[K, V]{
+		Container: rbtree.New[K, *intervalItem[K, V]](comparator.OrderedTypeCmp),
+		GetIndex:  getIndex,
+	}
+	mib.Container.SetAugment(func(n *intervalNode[K, V]) {
+		item := n.Value()
+		item.maxHi = item.hi
+		if l := n.Left(); l != nil && l.Value().maxHi > item.maxHi {
+			item.maxHi = l.Value().maxHi
+		}
+		if r := n.Right(); r != nil && r.Value().maxHi > item.maxHi {
+			item.maxHi = r.Value().maxHi
+		}
+	})
+	return mib
+}
+
+func (t *MultiIndexByInterval[K, V]) Insert(v V) multiindex.ConstIterator[V] {
+	lo, hi := t.GetIndex(v)
+	if hi < lo {
+		return nil
+	}
+	node := t.Container.Insert(lo, &intervalItem[K, V]{hi: hi, maxHi: hi, value: v})
+	return IntervalIterator[K, V]{node: node}
+}
+
+func (t *MultiIndexByInterval[K, V]) FindValue(v V) multiindex.ConstIterator[V] {
+	lo, _ := t.GetIndex(v)
+
+	for node := t.Container.FindLowerBoundNode(lo); node != nil && node.Key() == lo; node = node.Next() {
+		if node.Value().value == v {
+			return IntervalIterator[K, V]{node: node}
+		}
+	}
+
+	return nil
+}
+
+func (t *MultiIndexByInterval[K, V]) Erase_Internal(it multiindex.ConstIterator[V]) {
+	iter, ok := it.(IntervalIterator[K, V])
+	if !ok {
+		panic("wrong iterator")
+	}
+	t.Container.Delete(iter.node)
+}
+
+func (t *MultiIndexByInterval[K, V]) Size() int {
+	return t.Container.Size()
+}
+
+// TraversalKV visits elements ordered by the start of their range
+func (t *MultiIndexByInterval[K, V]) TraversalKV(visitor func(lo K, v V) bool) {
+	t.Container.Traversal(func(lo K, item *intervalItem[K, V]) bool {
+		return visitor(lo, item.value)
+	})
+}
+
+func (t *MultiIndexByInterval[K, V]) TraversalValue(visitor func(v V) bool) {
+	t.Container.Traversal(func(_ K, item *intervalItem[K, V]) bool {
+		return visitor(item.value)
+	})
+}
+
+func (t *MultiIndexByInterval[K, V]) All() iter.Seq2[K, V] {
+	return t.TraversalKV
+}
+
+// Overlapping yields elements whose range [a, b) overlaps [lo, hi), i.e. a < hi && lo < b
+func (t *MultiIndexByInterval[K, V]) Overlapping(lo, hi K) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		t.overlapping(t.Container.Root(), lo, hi, func(lo, hi K) bool { return lo < hi }, yield)
+	}
+}
+
+// Containing yields elements whose range [a, b) contains `point`
+func (t *MultiIndexByInterval[K, V]) Containing(point K) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		t.overlapping(t.Container.Root(), point, point, func(lo, hi K) bool { return lo <= hi }, yield)
+	}
+}
+
+// Stabbing yields, once each, the elements whose range contains at least one of `points`
+func (t *MultiIndexByInterval[K, V]) Stabbing(points ...K) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		seen := make(map[V]struct{})
+		for _, p := range points {
+			for v := range t.Containing(p) {
+				if _, ok := seen[v]; ok {
+					continue
+				}
+				seen[v] = struct{}{}
+				if !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// overlapping visits [a, b) with lo < b and startsBefore(a, hi)
+func (t *MultiIndexByInterval[K, V]) overlapping(
+	node *intervalNode[K, V],
+	lo, hi K,
+	startsBefore func(a, hi K) bool,
+	yield func(V) bool,
+) bool {
+	if node == nil || node.Value().maxHi <= lo {
+		return true
+	}
+	if !t.overlapping(node.Left(), lo, hi, startsBefore, yield) {
+		return false
+	}
+	if !startsBefore(node.Key(), hi) {
+		// everything to the right starts even later
+		return true
+	}
+	item := node.Value()
+	if lo < item.hi && !yield(item.value) {
+		return false
+	}
+	return t.overlapping(node.Right(), lo, hi, startsBefore, yield)
+}
+
+type IntervalIterator[K comparator.Ordered, V comparable] struct {
+	node *intervalNode[K, V]
+}
+
+func (iter IntervalIterator[K, V]) IsValid() bool {
+	return iter.node != nil
+}
+
+func (iter IntervalIterator[K, V]) Value() V {
+	return iter.node.Value().value
+}
+
+func (t *MultiIndexByInterval[K, V]) Describe() multiindex.IndexInfo {
+	distinct := make(map[[2]K]bool)
+	for node := t.Container.First(); node != nil; node = node.Next() {
+		distinct[[2]K{node.Key(), node.Value().hi}] = true
+	}
+	return multiindex.IndexInfo{
+		Kind:         "interval",
+		Ordered:      true,
+		KeyType:      "[" + keyTypeName[K]() + ", " + keyTypeName[K]() + "]",
+		DistinctKeys: len(distinct),
+	}
+}
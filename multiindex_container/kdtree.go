@@ -0,0 +1,392 @@
+package multiindex_container
+
+import (
+	"container/heap"
+	"iter"
+	"math"
+	"reflect"
+	"slices"
+
+	"github.com/agmt/go-multiindex"
+)
+
+// Metric measures the distance between two points of a MultiIndexByKDTree
+type Metric interface {
+	Distance(a, b []float64) float64
+	// AxisDistance is a lower bound of Distance for points which differ by `d` along a single axis.
+	// It lets the tree skip subtrees lying on the far side of a splitting plane.
+	AxisDistance(d float64) float64
+}
+
+type Euclidean struct{}
+
+func (Euclidean) Distance(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+func (Euclidean) AxisDistance(d float64) float64 {
+	return math.Abs(d)
+}
+
+type Manhattan struct{}
+
+func (Manhattan) Distance(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += math.Abs(a[i] - b[i])
+	}
+	return sum
+}
+
+func (Manhattan) AxisDistance(d float64) float64 {
+	return math.Abs(d)
+}
+
+type Chebyshev struct{}
+
+func (Chebyshev) Distance(a, b []float64) float64 {
+	max := 0.0
+	for i := range a {
+		max = math.Max(max, math.Abs(a[i]-b[i]))
+	}
+	return max
+}
+
+func (Chebyshev) AxisDistance(d float64) float64 {
+	return math.Abs(d)
+}
+
+type kdNode[V comparable] struct {
+	point   []float64
+	value   V
+	axis    int
+	deleted bool
+	left    *kdNode[V]
+	right   *kdNode[V]
+}
+
+// MultiIndexByKDTree is a non-unique index of points of a fixed dimension.
+// Erased elements are only marked as deleted, and the whole tree is rebuilt once they outnumber
+// live ones. An Insert making the tree too deep rebuilds the smallest unbalanced subtree above it,
+// as in a scapegoat tree. Queries never modify the tree.
+type MultiIndexByKDTree[V comparable] struct {
+	GetIndex func(v V) []float64
+	Dim      int
+	Metric   Metric
+	root     *kdNode[V]
+	size     int
+	dead     int
+	rebuilt  int
+}
+
+// kdAlpha is the weight balance of the tree: no subtree holds more than this share of its parent,
+// which bounds the depth to log(n)/log(1/kdAlpha)
+const kdAlpha = 2.0 / 3
+
+// NewKDTree creates a k-d tree over `dim`-dimensional points; nil `metric` means Euclidean
+func NewKDTree[V comparable](
+	dim int,
+	getIndex func(v V) []float64,
+	metric Metric,
+) *MultiIndexByKDTree[V] {
+	if metric == nil {
+		metric = Euclidean{}
+	}
+	mib := &MultiIndexByKDTree[V]{
+		GetIndex: getIndex,
+		Dim:      dim,
+		Metric:   metric,
+	}
+	return mib
+}
+
+func (t *MultiIndexByKDTree[V]) Insert(v V) multiindex.ConstIterator[V] {
+	p := t.GetIndex(v)
+	if len(p) != t.Dim {
+		return nil
+	}
+
+	node := &kdNode[V]{point: p, value: v}
+	var path []**kdNode[V] // links from the root to the parent of `node`
+	link := &t.root
+	for *link != nil {
+		path = append(path, link)
+		n := *link
+		if p[n.axis] < n.point[n.axis] {
+			link = &n.left
+		} else {
+			link = &n.right
+		}
+	}
+	node.axis = len(path) % t.Dim
+	*link = node
+
+	t.size++
+	if float64(len(path)) > math.Log(float64(t.size+t.dead))/math.Log(1/kdAlpha) {
+		t.rebuildScapegoat(path, node)
+	}
+	return NewMapNonUniqueIterator(v)
+}
+
+func (t *MultiIndexByKDTree[V]) FindValue(v V) (iter multiindex.ConstIterator[V]) {
+	if t.find(t.root, t.GetIndex(v), v) == nil {
+		return
+	}
+	return NewMapNonUniqueIterator(v)
+}
+
+func (t *MultiIndexByKDTree[V]) Erase_Internal(it multiindex.ConstIterator[V]) {
+	iter, ok := it.(MapNonUniqueIterator[V])
+	if !ok {
+		panic("wrong iterator")
+	}
+	node := t.find(t.root, t.GetIndex(iter.ptr), iter.ptr)
+	if node == nil {
+		return
+	}
+	node.deleted = true
+	t.size--
+	t.dead++
+	if t.dead > t.size {
+		t.rebuild(&t.root, 1)
+	}
+}
+
+func (t *MultiIndexByKDTree[V]) Size() int {
+	return t.size
+}
+
+// Rebuilt returns the number of nodes moved by rebalancing so far.
+// It is amortized O(log n) per Insert or Erase.
+func (t *MultiIndexByKDTree[V]) Rebuilt() int {
+	return t.rebuilt
+}
+
+func (t *MultiIndexByKDTree[V]) TraversalKV(visitor func(k []float64, v V) bool) {
+	t.traverse(t.root, visitor)
+}
+
+func (t *MultiIndexByKDTree[V]) TraversalValue(visitor func(v V) bool) {
+	t.traverse(t.root, func(_ []float64, v V) bool {
+		return visitor(v)
+	})
+}
+
+func (t *MultiIndexByKDTree[V]) All() iter.Seq2[[]float64, V] {
+	return t.TraversalKV
+}
+
+// Nearest returns up to `k` elements closest to `p`, nearest first
+func (t *MultiIndexByKDTree[V]) Nearest(p []float64, k int) []V {
+	if k <= 0 || len(p) != t.Dim {
+		return nil
+	}
+	h := &kdHeap[V]{}
+	t.nearest(t.root, p, k, h)
+
+	res := make([]V, h.Len())
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = heap.Pop(h).(kdCandidate[V]).node.value
+	}
+	return res
+}
+
+// WithinRadius yields the elements at distance <= r from `p`, in no particular order
+func (t *MultiIndexByKDTree[V]) WithinRadius(p []float64, r float64) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		if len(p) != t.Dim {
+			return
+		}
+		t.withinRadius(t.root, p, r, yield)
+	}
+}
+
+func (t *MultiIndexByKDTree[V]) traverse(n *kdNode[V], visitor func(k []float64, v V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if !n.deleted && !visitor(n.point, n.value) {
+		return false
+	}
+	return t.traverse(n.left, visitor) && t.traverse(n.right, visitor)
+}
+
+func (t *MultiIndexByKDTree[V]) find(n *kdNode[V], p []float64, v V) *kdNode[V] {
+	for n != nil {
+		if !n.deleted && n.value == v {
+			return n
+		}
+		switch {
+		case p[n.axis] < n.point[n.axis]:
+			n = n.left
+		case p[n.axis] > n.point[n.axis]:
+			n = n.right
+		default:
+			// equal coordinates may end up on either side after a rebuild
+			if found := t.find(n.left, p, v); found != nil {
+				return found
+			}
+			n = n.right
+		}
+	}
+	return nil
+}
+
+func (t *MultiIndexByKDTree[V]) nearest(n *kdNode[V], p []float64, k int, h *kdHeap[V]) {
+	if n == nil {
+		return
+	}
+	if !n.deleted {
+		d := t.Metric.Distance(p, n.point)
+		if h.Len() < k {
+			heap.Push(h, kdCandidate[V]{node: n, dist: d})
+		} else if d < (*h)[0].dist {
+			(*h)[0] = kdCandidate[V]{node: n, dist: d}
+			heap.Fix(h, 0)
+		}
+	}
+
+	diff := p[n.axis] - n.point[n.axis]
+	near, far := n.left, n.right
+	if diff >= 0 {
+		near, far = far, near
+	}
+	t.nearest(near, p, k, h)
+	if h.Len() < k || t.Metric.AxisDistance(diff) <= (*h)[0].dist {
+		t.nearest(far, p, k, h)
+	}
+}
+
+func (t *MultiIndexByKDTree[V]) withinRadius(n *kdNode[V], p []float64, r float64, yield func(V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if !n.deleted && t.Metric.Distance(p, n.point) <= r && !yield(n.value) {
+		return false
+	}
+
+	diff := p[n.axis] - n.point[n.axis]
+	if diff <= 0 || t.Metric.AxisDistance(diff) <= r {
+		if !t.withinRadius(n.left, p, r, yield) {
+			return false
+		}
+	}
+	if diff >= 0 || t.Metric.AxisDistance(diff) <= r {
+		if !t.withinRadius(n.right, p, r, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// rebuildScapegoat rebuilds the lowest subtree on `path` too unbalanced to hold `node` at its depth
+func (t *MultiIndexByKDTree[V]) rebuildScapegoat(path []**kdNode[V], node *kdNode[V]) {
+	size := 1
+	child := node
+	for i := len(path) - 1; i >= 0; i-- {
+		parent := *path[i]
+		sibling := parent.left
+		if sibling == child {
+			sibling = parent.right
+		}
+		total := size + t.countNodes(sibling) + 1
+		if float64(size) > kdAlpha*float64(total) {
+			t.rebuild(path[i], i+1)
+			return
+		}
+		size, child = total, parent
+	}
+}
+
+func (t *MultiIndexByKDTree[V]) countNodes(n *kdNode[V]) int {
+	if n == nil {
+		return 0
+	}
+	return 1 + t.countNodes(n.left) + t.countNodes(n.right)
+}
+
+// rebuild balances the subtree at `link`, at `depth` in the tree, dropping its tombstones
+func (t *MultiIndexByKDTree[V]) rebuild(link **kdNode[V], depth int) {
+	var nodes []*kdNode[V]
+	t.traverseNodes(*link, func(n *kdNode[V]) {
+		if n.deleted {
+			t.dead--
+			return
+		}
+		n.left, n.right = nil, nil
+		nodes = append(nodes, n)
+	})
+	*link = t.build(nodes, depth)
+	t.rebuilt += len(nodes)
+}
+
+func (t *MultiIndexByKDTree[V]) traverseNodes(n *kdNode[V], visitor func(n *kdNode[V])) {
+	if n == nil {
+		return
+	}
+	left, right := n.left, n.right
+	visitor(n)
+	t.traverseNodes(left, visitor)
+	t.traverseNodes(right, visitor)
+}
+
+func (t *MultiIndexByKDTree[V]) build(nodes []*kdNode[V], depth int) *kdNode[V] {
+	if len(nodes) == 0 {
+		return nil
+	}
+	axis := (depth - 1) % t.Dim
+	slices.SortFunc(nodes, func(a, b *kdNode[V]) int {
+		switch {
+		case a.point[axis] < b.point[axis]:
+			return -1
+		case a.point[axis] > b.point[axis]:
+			return 1
+		}
+		return 0
+	})
+	// nodes equal to the median may go to either side, so that duplicates stay balanced;
+	// find and the queries look on both sides of an equal coordinate
+	mid := len(nodes) / 2
+
+	n := nodes[mid]
+	n.axis = axis
+	n.left = t.build(nodes[:mid], depth+1)
+	n.right = t.build(nodes[mid+1:], depth+1)
+	return n
+}
+
+type kdCandidate[V comparable] struct {
+	node *kdNode[V]
+	dist float64
+}
+
+// kdHeap is a max-heap by distance, so the worst of the best `k` is at the top
+type kdHeap[V comparable] []kdCandidate[V]
+
+func (h kdHeap[V]) Len() int           { return len(h) }
+func (h kdHeap[V]) Less(i, j int) bool { return h[i].dist > h[j].dist }
+func (h kdHeap[V]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *kdHeap[V]) Push(x any) {
+	*h = append(*h, x.(kdCandidate[V]))
+}
+
+func (h *kdHeap[V]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (t *MultiIndexByKDTree[V]) Describe() multiindex.IndexInfo {
+	return multiindex.IndexInfo{
+		Kind:         "kdtree",
+		KeyType:      reflect.ArrayOf(t.Dim, reflect.TypeFor[float64]()).String(),
+		DistinctKeys: -1,
+	}
+}
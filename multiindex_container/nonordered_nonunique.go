@@ -2,6 +2,7 @@ package multiindex_container
 
 import (
 	"iter"
+	"reflect"
 
 	"github.com/agmt/go-multiindex"
 )
@@ -9,14 +10,21 @@ import (
 type MultiIndexByNonOrderedNonUnique[K comparable, V comparable] struct {
 	Container map[K]map[V]bool
 	GetIndex  func(v V) K
+	Normalize func(k K) K
+	encoding  keyEncoding[K]
+	onAccess  func(v V)
 }
 
 func NewNonOrderedNonUnique[K comparable, V comparable](
 	getIndex func(v V) K,
+	opts ...Option[K],
 ) *MultiIndexByNonOrderedNonUnique[K, V] {
+	o := newOptions(opts)
 	mib := &MultiIndexByNonOrderedNonUnique[K, V]{
 		Container: make(map[K]map[V]bool),
-		GetIndex:  getIndex,
+		GetIndex:  normalizedGetIndex(o, getIndex),
+		Normalize: o.normalize,
+		encoding:  o.encoding,
 	}
 	return mib
 }
@@ -33,12 +41,15 @@ func (t *MultiIndexByNonOrderedNonUnique[K, V]) Insert(v V) multiindex.ConstIter
 }
 
 func (t *MultiIndexByNonOrderedNonUnique[K, V]) Find(key K) (iter multiindex.ConstIterator[V]) {
-	rangeCont := t.Container[key]
+	rangeCont := t.Container[normalizeKey(t.Normalize, key)]
 	if rangeCont == nil {
 		return
 	}
 
 	for v := range rangeCont {
+		if t.onAccess != nil {
+			t.onAccess(v)
+		}
 		return NewMapNonUniqueIterator(v)
 	}
 	return
@@ -77,6 +88,15 @@ func (t *MultiIndexByNonOrderedNonUnique[K, V]) Erase_Internal(it multiindex.Con
 	}
 }
 
+// CountKey returns the number of elements with the key of `v`
+func (t *MultiIndexByNonOrderedNonUnique[K, V]) CountKey(v V) int {
+	return len(t.Container[t.GetIndex(v)])
+}
+
+func (t *MultiIndexByNonOrderedNonUnique[K, V]) ObserveAccess(onAccess func(v V)) {
+	t.onAccess = onAccess
+}
+
 func (t *MultiIndexByNonOrderedNonUnique[K, V]) Size() int {
 	sz := 0
 	for _, subCont := range t.Container {
@@ -106,7 +126,7 @@ func (t *MultiIndexByNonOrderedNonUnique[K, V]) TraversalValue(visitor func(vwi
 }
 
 func (t *MultiIndexByNonOrderedNonUnique[K, V]) TraversalWithKey(k K, visitor func(v V) bool) {
-	cont := t.Container[k]
+	cont := t.Container[normalizeKey(t.Normalize, k)]
 	if cont == nil {
 		return
 	}
@@ -121,9 +141,15 @@ func (t *MultiIndexByNonOrderedNonUnique[K, V]) All() iter.Seq2[K, V] {
 	return t.TraversalKV
 }
 
+// Where yields the elements with key `k`, each counting as an access (see multiindex.AccessObserver)
 func (t *MultiIndexByNonOrderedNonUnique[K, V]) Where(k K) iter.Seq[V] {
 	return func(yield func(V) bool) {
-		t.TraversalWithKey(k, yield)
+		t.TraversalWithKey(k, func(v V) bool {
+			if t.onAccess != nil {
+				t.onAccess(v)
+			}
+			return yield(v)
+		})
 	}
 }
 
@@ -146,3 +172,43 @@ func (iter MapNonUniqueIterator[V]) IsValid() bool {
 func (iter MapNonUniqueIterator[V]) Value() V {
 	return iter.ptr
 }
+
+func (t *MultiIndexByNonOrderedNonUnique[K, V]) Describe() multiindex.IndexInfo {
+	return multiindex.IndexInfo{
+		Kind:         "hashed",
+		KeyType:      t.encoding.queryKeyType().String(),
+		DistinctKeys: len(t.Container),
+	}
+}
+
+func (t *MultiIndexByNonOrderedNonUnique[K, V]) Stats() (size, distinct int) {
+	return t.Size(), len(t.Container)
+}
+
+func (t *MultiIndexByNonOrderedNonUnique[K, V]) KeyType() reflect.Type {
+	return t.encoding.queryKeyType()
+}
+
+func (t *MultiIndexByNonOrderedNonUnique[K, V]) Seek(p multiindex.Predicate) (iter.Seq[V], error) {
+	k, err := pointKey(p, t.Normalize, t.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(V) bool) {
+		for v := range t.Container[k] {
+			if !yield(v) {
+				return
+			}
+		}
+	}, nil
+}
+
+func (t *MultiIndexByNonOrderedNonUnique[K, V]) Matcher(p multiindex.Predicate) (func(v V) bool, error) {
+	k, err := pointKey(p, t.Normalize, t.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(v V) bool {
+		return t.GetIndex(v) == k
+	}, nil
+}
@@ -2,6 +2,7 @@ package multiindex_container
 
 import (
 	"iter"
+	"reflect"
 
 	"github.com/agmt/go-multiindex"
 )
@@ -9,14 +10,21 @@ import (
 type MultiIndexByNonOrderedUnique[K comparable, V comparable] struct {
 	Container map[K]V
 	GetIndex  func(v V) K
+	Normalize func(k K) K
+	encoding  keyEncoding[K]
+	onAccess  func(v V)
 }
 
 func NewNonOrderedUnique[K comparable, V comparable](
 	getIndex func(v V) K,
+	opts ...Option[K],
 ) *MultiIndexByNonOrderedUnique[K, V] {
+	o := newOptions(opts)
 	mib := &MultiIndexByNonOrderedUnique[K, V]{
 		Container: make(map[K]V),
-		GetIndex:  getIndex,
+		GetIndex:  normalizedGetIndex(o, getIndex),
+		Normalize: o.normalize,
+		encoding:  o.encoding,
 	}
 	return mib
 }
@@ -35,14 +43,22 @@ func (t *MultiIndexByNonOrderedUnique[K, V]) Insert(v V) multiindex.ConstIterato
 }
 
 func (t *MultiIndexByNonOrderedUnique[K, V]) Find(key K) multiindex.ConstIterator[V] {
-	return MapIterator[K, V]{
-		Key: key,
+	it := MapIterator[K, V]{
+		Key: normalizeKey(t.Normalize, key),
 		Map: t.Container,
 	}
+	if t.onAccess != nil && it.IsValid() {
+		t.onAccess(it.Value())
+	}
+	return it
 }
 
 func (t *MultiIndexByNonOrderedUnique[K, V]) FindValue(v V) multiindex.ConstIterator[V] {
 	key := t.GetIndex(v)
+	if stored, ok := t.Container[key]; ok && stored != v {
+		// another element has the same key
+		return nil
+	}
 
 	return MapIterator[K, V]{
 		Key: key,
@@ -58,6 +74,10 @@ func (t *MultiIndexByNonOrderedUnique[K, V]) Erase_Internal(it multiindex.ConstI
 	delete(t.Container, iter.Key)
 }
 
+func (t *MultiIndexByNonOrderedUnique[K, V]) ObserveAccess(onAccess func(v V)) {
+	t.onAccess = onAccess
+}
+
 func (t *MultiIndexByNonOrderedUnique[K, V]) Size() int {
 	return len(t.Container)
 }
@@ -79,7 +99,7 @@ func (t *MultiIndexByNonOrderedUnique[K, V]) TraversalValue(visitor func(v V) bo
 }
 
 func (t *MultiIndexByNonOrderedUnique[K, V]) TraversalWithKey(k K, visitor func(v V) bool) {
-	v, ok := t.Container[k]
+	v, ok := t.Container[normalizeKey(t.Normalize, k)]
 	if !ok {
 		return
 	}
@@ -90,9 +110,15 @@ func (t *MultiIndexByNonOrderedUnique[K, V]) All() iter.Seq2[K, V] {
 	return t.TraversalKV
 }
 
+// Where yields the elements with key `k`, each counting as an access (see multiindex.AccessObserver)
 func (t *MultiIndexByNonOrderedUnique[K, V]) Where(k K) iter.Seq[V] {
 	return func(yield func(V) bool) {
-		t.TraversalWithKey(k, yield)
+		t.TraversalWithKey(k, func(v V) bool {
+			if t.onAccess != nil {
+				t.onAccess(v)
+			}
+			return yield(v)
+		})
 	}
 }
 
@@ -109,3 +135,42 @@ func (it MapIterator[K, V]) IsValid() bool {
 func (it MapIterator[K, V]) Value() V {
 	return it.Map[it.Key]
 }
+
+func (t *MultiIndexByNonOrderedUnique[K, V]) Describe() multiindex.IndexInfo {
+	return multiindex.IndexInfo{
+		Kind:         "hashed",
+		Unique:       true,
+		KeyType:      t.encoding.queryKeyType().String(),
+		DistinctKeys: len(t.Container),
+	}
+}
+
+func (t *MultiIndexByNonOrderedUnique[K, V]) Stats() (size, distinct int) {
+	return len(t.Container), len(t.Container)
+}
+
+func (t *MultiIndexByNonOrderedUnique[K, V]) KeyType() reflect.Type {
+	return t.encoding.queryKeyType()
+}
+
+func (t *MultiIndexByNonOrderedUnique[K, V]) Seek(p multiindex.Predicate) (iter.Seq[V], error) {
+	k, err := pointKey(p, t.Normalize, t.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(V) bool) {
+		if v, ok := t.Container[k]; ok {
+			yield(v)
+		}
+	}, nil
+}
+
+func (t *MultiIndexByNonOrderedUnique[K, V]) Matcher(p multiindex.Predicate) (func(v V) bool, error) {
+	k, err := pointKey(p, t.Normalize, t.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(v V) bool {
+		return t.GetIndex(v) == k
+	}, nil
+}
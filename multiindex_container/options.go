@@ -0,0 +1,121 @@
+package multiindex_container
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/liyue201/gostl/utils/comparator"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+type options[K any] struct {
+	normalize func(k K) K
+	cmp       comparator.Comparator[K]
+	encoding  keyEncoding[K]
+}
+
+// keyEncoding lets an index be queried with keys of another type, which it encodes (see FromStruct)
+type keyEncoding[K any] struct {
+	encode  func(k any) (K, error) // nil if keys are queried as they are
+	keyType reflect.Type           // the type of query keys
+}
+
+func withKeyEncoding[K any](e keyEncoding[K]) Option[K] {
+	return func(o *options[K]) {
+		o.encoding = e
+	}
+}
+
+// queryKeyType returns the type of query keys of an index keyed by K
+func (e keyEncoding[K]) queryKeyType() reflect.Type {
+	if e.keyType != nil {
+		return e.keyType
+	}
+	return reflect.TypeFor[K]()
+}
+
+// Option customizes how a container treats its keys
+type Option[K any] func(o *options[K])
+
+// WithNormalizer makes the container index `normalize(key)`; lookups by key (Find, Where, ...)
+// are normalized the same way. See CaseFold and NFC for strings.
+func WithNormalizer[K any](normalize func(k K) K) Option[K] {
+	return func(o *options[K]) {
+		o.normalize = normalize
+	}
+}
+
+// WithComparator replaces the natural key order of ordered containers, see Collation
+func WithComparator[K any](cmp comparator.Comparator[K]) Option[K] {
+	return func(o *options[K]) {
+		o.cmp = cmp
+	}
+}
+
+func newOptions[K any](opts []Option[K]) options[K] {
+	o := options[K]{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// normalizedGetIndex composes the key extractor with the normalizer
+func normalizedGetIndex[K any, V comparable](o options[K], getIndex func(v V) K) func(v V) K {
+	if o.normalize == nil {
+		return getIndex
+	}
+	return func(v V) K {
+		return o.normalize(getIndex(v))
+	}
+}
+
+func normalizeKey[K any](normalize func(k K) K, k K) K {
+	if normalize == nil {
+		return k
+	}
+	return normalize(k)
+}
+
+// Normalizers chains several normalizers, e.g. Normalizers(NFC, CaseFold)
+func Normalizers[K any](normalizers ...func(k K) K) func(k K) K {
+	return func(k K) K {
+		for _, normalize := range normalizers {
+			k = normalize(k)
+		}
+		return k
+	}
+}
+
+// CaseFold applies Unicode case folding, so "Straße" and "STRASSE" become equal
+func CaseFold(s string) string {
+	return cases.Fold().String(s)
+}
+
+// NFC converts to the Unicode canonical composition form
+func NFC(s string) string {
+	return norm.NFC.String(s)
+}
+
+// NFKC converts to the Unicode compatibility composition form
+func NFKC(s string) string {
+	return norm.NFKC.String(s)
+}
+
+// Collation returns a locale-aware string comparator for ordered containers
+func Collation(tag language.Tag, opts ...collate.Option) comparator.Comparator[string] {
+	c := collate.New(tag, opts...)
+	var mu sync.Mutex // collate.Collator is not safe for concurrent use
+	return func(a, b string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return c.CompareString(a, b)
+	}
+}
+
+func keyTypeName[K any]() string {
+	return reflect.TypeFor[K]().String()
+}
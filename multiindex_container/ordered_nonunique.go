@@ -2,40 +2,81 @@ package multiindex_container
 
 import (
 	"iter"
+	"reflect"
+	"slices"
 
 	"github.com/agmt/go-multiindex"
 	rbtree "github.com/agmt/go-multiindex/gostl_rbtree"
 	"github.com/liyue201/gostl/utils/comparator"
 )
 
-type MultiIndexByOrderedNonUnique[K comparator.Ordered, V comparable] struct {
+type MultiIndexByOrderedNonUnique[K comparable, V comparable] struct {
 	Container *rbtree.RbTree[K, V]
 	GetIndex  func(v V) K
+	Normalize func(k K) K
+	Cmp       comparator.Comparator[K]
+	encoding  keyEncoding[K]
+	onAccess  func(v V)
+	distinct  int
 }
 
 func NewOrderedNonUnique[K comparator.Ordered, V comparable](
 	getIndex func(v V) K,
+	opts ...Option[K],
 ) *MultiIndexByOrderedNonUnique[K, V] {
-	mib := &MultiIndexByOrderedNonUnique[K, V]{
-		Container: rbtree.New[K, V](comparator.OrderedTypeCmp),
-		GetIndex:  getIndex,
+	mib := newOrderedNonUnique(getIndex, comparator.OrderedTypeCmp[K], opts)
+	return &mib
+}
+
+// newOrderedNonUnique orders keys with `cmp` unless an option sets another comparator
+func newOrderedNonUnique[K comparable, V comparable](
+	getIndex func(v V) K,
+	cmp comparator.Comparator[K],
+	opts []Option[K],
+) MultiIndexByOrderedNonUnique[K, V] {
+	o := newOptions(opts)
+	if o.cmp == nil {
+		o.cmp = cmp
+	}
+	return MultiIndexByOrderedNonUnique[K, V]{
+		Container: rbtree.New[K, V](o.cmp),
+		GetIndex:  normalizedGetIndex(o, getIndex),
+		Normalize: o.normalize,
+		encoding:  o.encoding,
+		Cmp:       o.cmp,
 	}
-	return mib
 }
 
 func (t *MultiIndexByOrderedNonUnique[K, V]) Insert(v V) multiindex.ConstIterator[V] {
 	key := t.GetIndex(v)
+	if t.Container.FindNode(key) == nil {
+		t.distinct++
+	}
 	return rbtree.NewIterator(t.Container.Insert(key, v))
 }
 
 func (t *MultiIndexByOrderedNonUnique[K, V]) Find(key K) multiindex.ConstIterator[V] {
-	return rbtree.NewIterator(t.Container.FindNode(key))
+	node := t.Container.FindNode(normalizeKey(t.Normalize, key))
+	if t.onAccess != nil && node != nil {
+		t.onAccess(node.Value())
+	}
+	return rbtree.NewIterator(node)
+}
+
+// Front returns the element with the smallest key
+func (t *MultiIndexByOrderedNonUnique[K, V]) Front() multiindex.ConstIterator[V] {
+	return rbtree.NewIterator(t.Container.First())
+}
+
+// Back returns the element with the greatest key
+func (t *MultiIndexByOrderedNonUnique[K, V]) Back() multiindex.ConstIterator[V] {
+	return rbtree.NewIterator(t.Container.Last())
 }
 
 func (t *MultiIndexByOrderedNonUnique[K, V]) FindValue(v V) multiindex.ConstIterator[V] {
 	key := t.GetIndex(v)
 
-	for node := t.Container.FindLowerBoundNode(key); node != nil; node = node.Next() {
+	for node := t.Container.FindLowerBoundNode(key); node != nil && t.Cmp(node.Key(), key) == 0; node = node.Next() {
 		if node.Value() == v {
 			return rbtree.NewIterator(node)
 		}
@@ -49,7 +90,34 @@ func (t *MultiIndexByOrderedNonUnique[K, V]) Erase_Internal(it multiindex.ConstI
 	if !ok {
 		panic("not iterator")
 	}
-	t.Container.DeleteIter(*iter)
+	node := iter.Node()
+	if !t.sameKey(node.Prev(), node.Key()) && !t.sameKey(node.Next(), node.Key()) {
+		t.distinct--
+	}
+	t.Container.Delete(node)
+}
+
+// CompareKeys compares keys in the order of the index, e.g. for multiindex.Join
+func (t *MultiIndexByOrderedNonUnique[K, V]) CompareKeys(a, b K) int {
+	return t.Cmp(a, b)
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) sameKey(node *rbtree.Node[K, V], k K) bool {
+	return node != nil && t.Cmp(node.Key(), k) == 0
+}
+
+// CountKey returns the number of elements with the key of `v`
+func (t *MultiIndexByOrderedNonUnique[K, V]) CountKey(v V) int {
+	key := t.GetIndex(v)
+	n := 0
+	for node := t.Container.FindLowerBoundNode(key); t.sameKey(node, key); node = node.Next() {
+		n++
+	}
+	return n
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) ObserveAccess(onAccess func(v V)) {
+	t.onAccess = onAccess
 }
 
 func (t *MultiIndexByOrderedNonUnique[K, V]) Size() int {
@@ -69,8 +137,9 @@ func (t *MultiIndexByOrderedNonUnique[K, V]) TraversalValue(visitor func(v V) bo
 }
 
 func (t *MultiIndexByOrderedNonUnique[K, V]) TraversalWithKey(k K, visitor func(v V) bool) {
+	k = normalizeKey(t.Normalize, k)
 	for node := t.Container.FindLowerBoundNode(k); node != nil; node = node.Next() {
-		if node.Key() != k {
+		if t.Cmp(node.Key(), k) != 0 {
 			return
 		}
 		if !visitor(node.Value()) {
@@ -83,8 +152,103 @@ func (t *MultiIndexByOrderedNonUnique[K, V]) All() iter.Seq2[K, V] {
 	return t.TraversalKV
 }
 
+// Where yields the elements with key `k`, each counting as an access (see multiindex.AccessObserver)
 func (t *MultiIndexByOrderedNonUnique[K, V]) Where(k K) iter.Seq[V] {
 	return func(yield func(V) bool) {
-		t.TraversalWithKey(k, yield)
+		t.TraversalWithKey(k, func(v V) bool {
+			if t.onAccess != nil {
+				t.onAccess(v)
+			}
+			return yield(v)
+		})
+	}
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) Describe() multiindex.IndexInfo {
+	return multiindex.IndexInfo{
+		Kind:         "ordered",
+		Ordered:      true,
+		KeyType:      t.encoding.queryKeyType().String(),
+		DistinctKeys: t.distinct,
+	}
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) Stats() (size, distinct int) {
+	return t.Container.Size(), t.distinct
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) KeyType() reflect.Type {
+	return t.encoding.queryKeyType()
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) Seek(p multiindex.Predicate) (iter.Seq[V], error) {
+	r, err := newKeyRange(p, t.Normalize, t.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(V) bool) {
+		node := t.Container.First()
+		switch {
+		case r.hasLo && r.loInclusive:
+			node = t.Container.FindLowerBoundNode(r.lo)
+		case r.hasLo:
+			node = t.Container.FindUpperBoundNode(r.lo)
+		}
+		for ; node != nil && r.belowHi(t.Cmp, node.Key()); node = node.Next() {
+			if !yield(node.Value()) {
+				return
+			}
+		}
+	}, nil
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) Matcher(p multiindex.Predicate) (func(v V) bool, error) {
+	r, err := newKeyRange(p, t.Normalize, t.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(v V) bool {
+		return r.contains(t.Cmp, t.GetIndex(v))
+	}, nil
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) CompareValues(a, b V) int {
+	return t.Cmp(t.GetIndex(a), t.GetIndex(b))
+}
+
+func (t *MultiIndexByOrderedNonUnique[K, V]) BulkLoad(vs []V) bool {
+	return t.bulkLoad(vs, false)
+}
+
+// bulkLoad sorts `vs` and builds the tree at once
+func (t *MultiIndexByOrderedNonUnique[K, V]) bulkLoad(vs []V, unique bool) bool {
+	if t.Container.Size() != 0 {
+		panic("BulkLoad into a non-empty index")
+	}
+	type item struct {
+		key   K
+		value V
+	}
+	items := make([]item, len(vs))
+	for i, v := range vs {
+		items[i] = item{t.GetIndex(v), v}
+	}
+	slices.SortStableFunc(items, func(a, b item) int {
+		return t.Cmp(a.key, b.key)
+	})
+
+	keys := make([]K, len(items))
+	values := make([]V, len(items))
+	distinct := 0
+	for i, it := range items {
+		if i == 0 || t.Cmp(items[i-1].key, it.key) != 0 {
+			distinct++
+		} else if unique {
+			return false
+		}
+		keys[i], values[i] = it.key, it.value
 	}
+	t.Container.BuildSorted(keys, values)
+	t.distinct = distinct
+	return true
 }
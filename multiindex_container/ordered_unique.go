@@ -6,23 +6,22 @@ import (
 	"github.com/liyue201/gostl/utils/comparator"
 )
 
-type MultiIndexByOrderedUnique[K comparator.Ordered, V comparable] struct {
+type MultiIndexByOrderedUnique[K comparable, V comparable] struct {
 	MultiIndexByOrderedNonUnique[K, V]
 }
 
 func NewOrderedUnique[K comparator.Ordered, V comparable](
 	getIndex func(v V) K,
+	opts ...Option[K],
 ) *MultiIndexByOrderedUnique[K, V] {
 	mib := &MultiIndexByOrderedUnique[K, V]{
-		MultiIndexByOrderedNonUnique[K, V]{
-			Container: rbtree.New[K, V](comparator.OrderedTypeCmp),
-			GetIndex:  getIndex,
-		},
+		newOrderedNonUnique(getIndex, comparator.OrderedTypeCmp[K], opts),
 	}
 	return mib
 }
 
-func (t *MultiIndexByOrderedUnique[K, V]) InsertVWI(v V) multiindex.ConstIterator[V] {
+// Insert rejects elements whose key is already present
+func (t *MultiIndexByOrderedUnique[K, V]) Insert(v V) multiindex.ConstIterator[V] {
 	key := t.GetIndex(v)
 
 	node := t.Container.FindNode(key)
@@ -30,6 +29,23 @@ func (t *MultiIndexByOrderedUnique[K, V]) InsertVWI(v V) multiindex.ConstIterato
 		return nil
 	}
 
+	t.distinct++
 	node = t.Container.Insert(key, v)
 	return rbtree.NewIterator(node)
 }
+
+// Deprecated: use Insert
+func (t *MultiIndexByOrderedUnique[K, V]) InsertVWI(v V) multiindex.ConstIterator[V] {
+	return t.Insert(v)
+}
+
+func (t *MultiIndexByOrderedUnique[K, V]) Describe() multiindex.IndexInfo {
+	info := t.MultiIndexByOrderedNonUnique.Describe()
+	info.Unique = true
+	return info
+}
+
+// BulkLoad rejects `vs` if two of them have the same key
+func (t *MultiIndexByOrderedUnique[K, V]) BulkLoad(vs []V) bool {
+	return t.bulkLoad(vs, true)
+}
@@ -0,0 +1,73 @@
+package multiindex_container
+
+import (
+	"fmt"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/liyue201/gostl/utils/comparator"
+)
+
+// queryKey converts a bound of a multiindex.Predicate to the key type of an index
+func queryKey[K any](b multiindex.Bound, normalize func(k K) K, e keyEncoding[K]) (K, error) {
+	if e.encode != nil {
+		k, err := e.encode(b.Key)
+		return normalizeKey(normalize, k), err
+	}
+	k, ok := b.Key.(K)
+	if !ok {
+		return k, fmt.Errorf("key %v (%T) is not %s", b.Key, b.Key, keyTypeName[K]())
+	}
+	return normalizeKey(normalize, k), nil
+}
+
+// pointKey is the key of an Eq predicate, the only one hashed indexes support
+func pointKey[K any](p multiindex.Predicate, normalize func(k K) K, e keyEncoding[K]) (K, error) {
+	if !p.IsPoint() {
+		var k K
+		return k, fmt.Errorf("%w: hashed indexes only support Eq", multiindex.ErrUnsupportedPredicate)
+	}
+	return queryKey(p.Lo, normalize, e)
+}
+
+type keyRange[K any] struct {
+	lo, hi       K
+	hasLo, hasHi bool
+	loInclusive  bool
+	hiInclusive  bool
+}
+
+func newKeyRange[K any](p multiindex.Predicate, normalize func(k K) K, e keyEncoding[K]) (r keyRange[K], err error) {
+	if p.Lo.Key != nil {
+		if r.lo, err = queryKey(p.Lo, normalize, e); err != nil {
+			return
+		}
+		r.hasLo, r.loInclusive = true, p.Lo.Inclusive
+	}
+	if p.Hi.Key != nil {
+		if r.hi, err = queryKey(p.Hi, normalize, e); err != nil {
+			return
+		}
+		r.hasHi, r.hiInclusive = true, p.Hi.Inclusive
+	}
+	return
+}
+
+func (r keyRange[K]) aboveLo(cmp comparator.Comparator[K], k K) bool {
+	if !r.hasLo {
+		return true
+	}
+	c := cmp(k, r.lo)
+	return c > 0 || c == 0 && r.loInclusive
+}
+
+func (r keyRange[K]) belowHi(cmp comparator.Comparator[K], k K) bool {
+	if !r.hasHi {
+		return true
+	}
+	c := cmp(k, r.hi)
+	return c < 0 || c == 0 && r.hiInclusive
+}
+
+func (r keyRange[K]) contains(cmp comparator.Comparator[K], k K) bool {
+	return r.aboveLo(cmp, k) && r.belowHi(cmp, k)
+}
@@ -0,0 +1,433 @@
+package multiindex_container
+
+import (
+	"iter"
+	"math"
+
+	"github.com/agmt/go-multiindex"
+)
+
+// Rect is an axis-aligned bounding box. Min and Max must have the same length
+// (2 for planar boxes, 3 for volumes, ...); boxes of different dimensions never
+// intersect or contain each other.
+type Rect struct {
+	Min []float64
+	Max []float64
+}
+
+func Rect2D(x0, y0, x1, y1 float64) Rect {
+	return Rect{
+		Min: []float64{math.Min(x0, x1), math.Min(y0, y1)},
+		Max: []float64{math.Max(x0, x1), math.Max(y0, y1)},
+	}
+}
+
+func Rect3D(x0, y0, z0, x1, y1, z1 float64) Rect {
+	return Rect{
+		Min: []float64{math.Min(x0, x1), math.Min(y0, y1), math.Min(z0, z1)},
+		Max: []float64{math.Max(x0, x1), math.Max(y0, y1), math.Max(z0, z1)},
+	}
+}
+
+// dim is the number of axes of r, or -1 when Min and Max disagree
+func (r Rect) dim() int {
+	if len(r.Min) != len(r.Max) {
+		return -1
+	}
+	return len(r.Min)
+}
+
+// Intersects reports whether r and o share at least one point (borders included)
+func (r Rect) Intersects(o Rect) bool {
+	if r.dim() < 0 || r.dim() != o.dim() {
+		return false
+	}
+	for i := range r.Min {
+		if r.Min[i] > o.Max[i] || o.Min[i] > r.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains reports whether o lies entirely inside r
+func (r Rect) Contains(o Rect) bool {
+	if r.dim() < 0 || r.dim() != o.dim() {
+		return false
+	}
+	for i := range r.Min {
+		if o.Min[i] < r.Min[i] || o.Max[i] > r.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Rect) Equal(o Rect) bool {
+	if r.dim() < 0 || r.dim() != o.dim() {
+		return false
+	}
+	for i := range r.Min {
+		if r.Min[i] != o.Min[i] || r.Max[i] != o.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Rect) area() float64 {
+	a := 1.0
+	for i := range r.Min {
+		a *= r.Max[i] - r.Min[i]
+	}
+	return a
+}
+
+func (r Rect) union(o Rect) Rect {
+	u := Rect{
+		Min: make([]float64, len(r.Min)),
+		Max: make([]float64, len(r.Max)),
+	}
+	for i := range r.Min {
+		u.Min[i] = math.Min(r.Min[i], o.Min[i])
+		u.Max[i] = math.Max(r.Max[i], o.Max[i])
+	}
+	return u
+}
+
+func (r Rect) enlargement(o Rect) float64 {
+	return r.union(o).area() - r.area()
+}
+
+const (
+	rtreeMaxEntries = 8
+	rtreeMinEntries = rtreeMaxEntries * 2 / 5
+)
+
+type rtreeEntry[V comparable] struct {
+	rect  Rect
+	child *rtreeNode[V] // nil in leaves
+	value V
+}
+
+type rtreeNode[V comparable] struct {
+	parent  *rtreeNode[V]
+	leaf    bool
+	entries []rtreeEntry[V]
+}
+
+func (n *rtreeNode[V]) bounds() Rect {
+	r := n.entries[0].rect
+	for _, e := range n.entries[1:] {
+		r = r.union(e.rect)
+	}
+	return r
+}
+
+func (n *rtreeNode[V]) entryOf(child *rtreeNode[V]) int {
+	for i := range n.entries {
+		if n.entries[i].child == child {
+			return i
+		}
+	}
+	panic("rtree: child is not linked to its parent")
+}
+
+// MultiIndexByRTree is a non-unique spatial index (Guttman R-tree, quadratic split).
+// All boxes share the dimension of the first one inserted into the empty tree: boxes of
+// another dimension are rejected by Insert and match nothing in queries.
+type MultiIndexByRTree[V comparable] struct {
+	GetIndex func(v V) Rect
+	root     *rtreeNode[V]
+	size     int
+	dim      int
+}
+
+func NewRTree[V comparable](
+	getIndex func(v V) Rect,
+) *MultiIndexByRTree[V] {
+	mib := &MultiIndexByRTree[V]{
+		GetIndex: getIndex,
+		root:     &rtreeNode[V]{leaf: true},
+	}
+	return mib
+}
+
+func (t *MultiIndexByRTree[V]) Insert(v V) multiindex.ConstIterator[V] {
+	rect := t.GetIndex(v)
+	if d := rect.dim(); d < 1 || (t.size > 0 && d != t.dim) {
+		return nil
+	}
+	t.dim = rect.dim()
+	t.insert(rtreeEntry[V]{rect: rect, value: v})
+	t.size++
+	return NewMapNonUniqueIterator(v)
+}
+
+func (t *MultiIndexByRTree[V]) FindValue(v V) (iter multiindex.ConstIterator[V]) {
+	if t.findLeaf(t.root, t.GetIndex(v), v) == nil {
+		return
+	}
+	return NewMapNonUniqueIterator(v)
+}
+
+func (t *MultiIndexByRTree[V]) Erase_Internal(it multiindex.ConstIterator[V]) {
+	iter, ok := it.(MapNonUniqueIterator[V])
+	if !ok {
+		panic("wrong iterator")
+	}
+	rect := t.GetIndex(iter.ptr)
+	leaf := t.findLeaf(t.root, rect, iter.ptr)
+	if leaf == nil {
+		return
+	}
+	for i := range leaf.entries {
+		if leaf.entries[i].child == nil && leaf.entries[i].value == iter.ptr {
+			leaf.entries = append(leaf.entries[:i], leaf.entries[i+1:]...)
+			break
+		}
+	}
+	t.size--
+	t.condense(leaf)
+}
+
+func (t *MultiIndexByRTree[V]) Size() int {
+	return t.size
+}
+
+func (t *MultiIndexByRTree[V]) TraversalKV(visitor func(k Rect, v V) bool) {
+	t.search(t.root, func(Rect) bool { return true }, func(Rect) bool { return true }, visitor)
+}
+
+func (t *MultiIndexByRTree[V]) TraversalValue(visitor func(v V) bool) {
+	t.TraversalKV(func(_ Rect, v V) bool {
+		return visitor(v)
+	})
+}
+
+func (t *MultiIndexByRTree[V]) All() iter.Seq2[Rect, V] {
+	return t.TraversalKV
+}
+
+// Intersects yields the elements whose box intersects r
+func (t *MultiIndexByRTree[V]) Intersects(r Rect) iter.Seq[V] {
+	return t.query(r.Intersects, r.Intersects)
+}
+
+// Contains yields the elements whose box contains r entirely
+func (t *MultiIndexByRTree[V]) Contains(r Rect) iter.Seq[V] {
+	return t.query(
+		func(b Rect) bool { return b.Contains(r) },
+		func(b Rect) bool { return b.Contains(r) },
+	)
+}
+
+// Within yields the elements whose box lies entirely inside r
+func (t *MultiIndexByRTree[V]) Within(r Rect) iter.Seq[V] {
+	return t.query(r.Intersects, r.Contains)
+}
+
+func (t *MultiIndexByRTree[V]) query(descend func(Rect) bool, match func(Rect) bool) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		t.search(t.root, descend, match, func(_ Rect, v V) bool {
+			return yield(v)
+		})
+	}
+}
+
+func (t *MultiIndexByRTree[V]) search(
+	n *rtreeNode[V],
+	descend func(Rect) bool,
+	match func(Rect) bool,
+	visitor func(k Rect, v V) bool,
+) bool {
+	for _, e := range n.entries {
+		if n.leaf {
+			if match(e.rect) && !visitor(e.rect, e.value) {
+				return false
+			}
+		} else if descend(e.rect) {
+			if !t.search(e.child, descend, match, visitor) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (t *MultiIndexByRTree[V]) findLeaf(n *rtreeNode[V], rect Rect, v V) *rtreeNode[V] {
+	for _, e := range n.entries {
+		if n.leaf {
+			if e.value == v {
+				return n
+			}
+		} else if e.rect.Contains(rect) {
+			if leaf := t.findLeaf(e.child, rect, v); leaf != nil {
+				return leaf
+			}
+		}
+	}
+	return nil
+}
+
+func (t *MultiIndexByRTree[V]) insert(e rtreeEntry[V]) {
+	n := t.root
+	for !n.leaf {
+		best := 0
+		bestEnl, bestArea := math.Inf(1), math.Inf(1)
+		for i, c := range n.entries {
+			enl, area := c.rect.enlargement(e.rect), c.rect.area()
+			if enl < bestEnl || (enl == bestEnl && area < bestArea) {
+				best, bestEnl, bestArea = i, enl, area
+			}
+		}
+		n = n.entries[best].child
+	}
+	n.entries = append(n.entries, e)
+
+	var split *rtreeNode[V]
+	if len(n.entries) > rtreeMaxEntries {
+		split = t.split(n)
+	}
+	for n != t.root {
+		parent := n.parent
+		parent.entries[parent.entryOf(n)].rect = n.bounds()
+		if split != nil {
+			split.parent = parent
+			parent.entries = append(parent.entries, rtreeEntry[V]{rect: split.bounds(), child: split})
+			split = nil
+			if len(parent.entries) > rtreeMaxEntries {
+				split = t.split(parent)
+			}
+		}
+		n = parent
+	}
+	if split != nil {
+		root := &rtreeNode[V]{
+			entries: []rtreeEntry[V]{
+				{rect: n.bounds(), child: n},
+				{rect: split.bounds(), child: split},
+			},
+		}
+		n.parent = root
+		split.parent = root
+		t.root = root
+	}
+}
+
+// split distributes the entries of `n` between `n` and a new sibling (quadratic split)
+func (t *MultiIndexByRTree[V]) split(n *rtreeNode[V]) *rtreeNode[V] {
+	entries := n.entries
+
+	seed1, seed2 := 0, 1
+	worst := math.Inf(-1)
+	for i := 0; i < len(entries); i++ {
+		for j := i + 1; j < len(entries); j++ {
+			d := entries[i].rect.union(entries[j].rect).area() - entries[i].rect.area() - entries[j].rect.area()
+			if d > worst {
+				seed1, seed2, worst = i, j, d
+			}
+		}
+	}
+
+	g1 := []rtreeEntry[V]{entries[seed1]}
+	g2 := []rtreeEntry[V]{entries[seed2]}
+	r1, r2 := entries[seed1].rect, entries[seed2].rect
+	rest := make([]rtreeEntry[V], 0, len(entries)-2)
+	for i, e := range entries {
+		if i != seed1 && i != seed2 {
+			rest = append(rest, e)
+		}
+	}
+
+	for len(rest) > 0 {
+		if len(g1)+len(rest) == rtreeMinEntries {
+			g1 = append(g1, rest...)
+			break
+		}
+		if len(g2)+len(rest) == rtreeMinEntries {
+			g2 = append(g2, rest...)
+			break
+		}
+
+		next := 0
+		maxDiff := math.Inf(-1)
+		for i, e := range rest {
+			diff := math.Abs(r1.enlargement(e.rect) - r2.enlargement(e.rect))
+			if diff > maxDiff {
+				next, maxDiff = i, diff
+			}
+		}
+		e := rest[next]
+		rest = append(rest[:next], rest[next+1:]...)
+
+		d1, d2 := r1.enlargement(e.rect), r2.enlargement(e.rect)
+		toFirst := d1 < d2 ||
+			(d1 == d2 && (r1.area() < r2.area() || (r1.area() == r2.area() && len(g1) <= len(g2))))
+		if toFirst {
+			g1 = append(g1, e)
+			r1 = r1.union(e.rect)
+		} else {
+			g2 = append(g2, e)
+			r2 = r2.union(e.rect)
+		}
+	}
+
+	sibling := &rtreeNode[V]{leaf: n.leaf, entries: g2}
+	n.entries = g1
+	if !n.leaf {
+		for _, e := range g1 {
+			e.child.parent = n
+		}
+		for _, e := range g2 {
+			e.child.parent = sibling
+		}
+	}
+	return sibling
+}
+
+// condense removes underfull nodes on the path from `n` to the root and reinserts their elements
+func (t *MultiIndexByRTree[V]) condense(n *rtreeNode[V]) {
+	var orphans []rtreeEntry[V]
+	for n != t.root {
+		parent := n.parent
+		i := parent.entryOf(n)
+		if len(n.entries) < rtreeMinEntries {
+			parent.entries = append(parent.entries[:i], parent.entries[i+1:]...)
+			orphans = t.collect(n, orphans)
+		} else {
+			parent.entries[i].rect = n.bounds()
+		}
+		n = parent
+	}
+
+	for !t.root.leaf && len(t.root.entries) == 1 {
+		t.root = t.root.entries[0].child
+		t.root.parent = nil
+	}
+	if !t.root.leaf && len(t.root.entries) == 0 {
+		t.root = &rtreeNode[V]{leaf: true}
+	}
+
+	for _, e := range orphans {
+		t.insert(e)
+	}
+}
+
+func (t *MultiIndexByRTree[V]) collect(n *rtreeNode[V], dst []rtreeEntry[V]) []rtreeEntry[V] {
+	if n.leaf {
+		return append(dst, n.entries...)
+	}
+	for _, e := range n.entries {
+		dst = t.collect(e.child, dst)
+	}
+	return dst
+}
+
+func (t *MultiIndexByRTree[V]) Describe() multiindex.IndexInfo {
+	return multiindex.IndexInfo{
+		Kind:         "rtree",
+		KeyType:      keyTypeName[Rect](),
+		DistinctKeys: -1,
+	}
+}
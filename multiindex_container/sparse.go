@@ -0,0 +1,52 @@
+package multiindex_container
+
+import (
+	"github.com/liyue201/gostl/utils/comparator"
+)
+
+// Sparse indexes take an extractor returning (key, ok); elements with !ok are not indexed.
+// They are partial indexes, so lookups go through `.Index`.
+
+func sparse[K any, V comparable](getIndex func(v V) (K, bool)) (func(v V) K, func(v V) bool) {
+	key := func(v V) K {
+		k, _ := getIndex(v)
+		return k
+	}
+	has := func(v V) bool {
+		_, ok := getIndex(v)
+		return ok
+	}
+	return key, has
+}
+
+func NewSparseOrderedUnique[K comparator.Ordered, V comparable](
+	getIndex func(v V) (K, bool),
+	opts ...Option[K],
+) *MultiIndexByFilter[V, *MultiIndexByOrderedUnique[K, V]] {
+	key, has := sparse(getIndex)
+	return Filter(NewOrderedUnique(key, opts...), has)
+}
+
+func NewSparseOrderedNonUnique[K comparator.Ordered, V comparable](
+	getIndex func(v V) (K, bool),
+	opts ...Option[K],
+) *MultiIndexByFilter[V, *MultiIndexByOrderedNonUnique[K, V]] {
+	key, has := sparse(getIndex)
+	return Filter(NewOrderedNonUnique(key, opts...), has)
+}
+
+func NewSparseNonOrderedUnique[K comparable, V comparable](
+	getIndex func(v V) (K, bool),
+	opts ...Option[K],
+) *MultiIndexByFilter[V, *MultiIndexByNonOrderedUnique[K, V]] {
+	key, has := sparse(getIndex)
+	return Filter(NewNonOrderedUnique(key, opts...), has)
+}
+
+func NewSparseNonOrderedNonUnique[K comparable, V comparable](
+	getIndex func(v V) (K, bool),
+	opts ...Option[K],
+) *MultiIndexByFilter[V, *MultiIndexByNonOrderedNonUnique[K, V]] {
+	key, has := sparse(getIndex)
+	return Filter(NewNonOrderedNonUnique(key, opts...), has)
+}
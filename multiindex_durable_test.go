@@ -0,0 +1,281 @@
+package multiindex_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+func newDurableIndex() (*multiindex.MultiIndex[Book], *multiindex_container.MultiIndexByOrderedUnique[string, Book]) {
+	m := multiindex.New[Book]()
+	byISBN := multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN })
+	m.AddNamedIndex("isbn", byISBN)
+	m.AddNamedIndex("author", multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Author }))
+	return m, byISBN
+}
+
+func openDurable(t *testing.T, dir string, opts multiindex.DurableOptions) (*multiindex.Durable[Book], *multiindex_container.MultiIndexByOrderedUnique[string, Book]) {
+	t.Helper()
+	m, byISBN := newDurableIndex()
+	d, err := multiindex.OpenDurable(dir, m, multiindex.GobCodec[Book]{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, byISBN
+}
+
+func durableContent(byISBN *multiindex_container.MultiIndexByOrderedUnique[string, Book]) []Book {
+	var res []Book
+	byISBN.TraversalValue(func(b Book) bool {
+		res = append(res, b)
+		return true
+	})
+	return res
+}
+
+func TestDurable(t *testing.T) {
+	dir := t.TempDir()
+	for _, policy := range []multiindex.SyncPolicy{multiindex.SyncAlways, multiindex.SyncBatch, multiindex.SyncNone} {
+		d, byISBN := openDurable(t, dir, multiindex.DurableOptions{Sync: policy, SegmentSize: 1 << 10})
+		for i := 0; i < 50; i++ {
+			b := Book{Name: fmt.Sprintf("%v %d", policy, i), ISBN: fmt.Sprintf("%v-%03d", policy, i)}
+			if ok, err := d.Insert(b); !ok || err != nil {
+				t.Fatalf("%v: %v", b, err)
+			}
+			if i%5 == 0 {
+				if err := d.Erase(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if i%7 == 0 {
+				b2 := b
+				b2.Author = "Verne"
+				if _, err := d.Modify(b, b2); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if ok, err := d.Insert(Book{ISBN: fmt.Sprintf("%v-%03d", policy, 1)}); ok || err != nil {
+			t.Errorf("duplicate: %v, %v", ok, err)
+		}
+		expected := durableContent(byISBN)
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		d, byISBN = openDurable(t, dir, multiindex.DurableOptions{})
+		if res := durableContent(byISBN); !slices.Equal(res, expected) {
+			t.Errorf("%v: %d elements != %d", policy, len(res), len(expected))
+		}
+		d.Close()
+	}
+
+	// rotated segments, then compacted away
+	segments, _ := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if len(segments) < 2 {
+		t.Errorf("not rotated: %v", segments)
+	}
+	d, byISBN := openDurable(t, dir, multiindex.DurableOptions{})
+	expected := durableContent(byISBN)
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	d.Insert(Book{ISBN: "after compaction"})
+	d.Close()
+	segments, _ = filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	snapshots, _ := filepath.Glob(filepath.Join(dir, "snapshot-*.snap"))
+	if len(segments) != 1 || len(snapshots) != 1 {
+		t.Errorf("not compacted: %v %v", segments, snapshots)
+	}
+	_, byISBN = openDurable(t, dir, multiindex.DurableOptions{})
+	if res := durableContent(byISBN); len(res) != len(expected)+1 || !slices.Equal(res[:len(expected)], expected) {
+		t.Errorf("after compaction: %d elements", len(res))
+	}
+}
+
+func TestDurableCorruptTail(t *testing.T) {
+	dir := t.TempDir()
+	d, _ := openDurable(t, dir, multiindex.DurableOptions{})
+	d.Insert(Book{ISBN: "1"})
+	d.Insert(Book{ISBN: "2"})
+	d.Close()
+
+	segment := filepath.Join(dir, "wal-0000000000000000.log")
+	data, _ := os.ReadFile(segment)
+	for _, tail := range [][]byte{data[:len(data)-3], append(slices.Clone(data), 5, 1, 2)} {
+		os.WriteFile(segment, tail, 0o644)
+		d, byISBN := openDurable(t, dir, multiindex.DurableOptions{})
+		if byISBN.Size() != 1 && byISBN.Size() != 2 {
+			t.Errorf("size %d", byISBN.Size())
+		}
+		d.Insert(Book{ISBN: "3"})
+		d.Close()
+
+		_, byISBN = openDurable(t, dir, multiindex.DurableOptions{})
+		if byISBN.Find("3") == nil || !byISBN.Find("3").IsValid() {
+			t.Errorf("appended after a cut tail: %v", durableContent(byISBN))
+		}
+		os.WriteFile(segment, data, 0o644)
+	}
+}
+
+func TestDurableExistingContent(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := newDurableIndex()
+	m.Insert(Book{ISBN: "1"})
+	d, err := multiindex.OpenDurable(dir, m, multiindex.JSONCodec[Book]{}, multiindex.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Insert(Book{ISBN: "2"}) // directly, written on Sync
+	d.Sync()
+	d.Close()
+
+	m, _ = newDurableIndex()
+	if _, err := multiindex.OpenDurable(dir, m, multiindex.JSONCodec[Book]{}, multiindex.DurableOptions{}); err != nil || m.Size() != 2 {
+		t.Errorf("%d, %v", m.Size(), err)
+	}
+	m.Insert(Book{ISBN: "3"})
+	if _, err := multiindex.OpenDurable(dir, m, multiindex.JSONCodec[Book]{}, multiindex.DurableOptions{}); err == nil {
+		t.Errorf("opened into a non-empty multiindex")
+	}
+}
+
+// failingCodec cannot encode books named "poison"
+type failingCodec struct {
+	multiindex.GobCodec[Book]
+}
+
+var errPoison = errors.New("poison")
+
+func (c failingCodec) Encode(b Book) ([]byte, error) {
+	if b.Name == "poison" {
+		return nil, errPoison
+	}
+	return c.GobCodec.Encode(b)
+}
+
+func TestDurableRecordFailure(t *testing.T) {
+	dir := t.TempDir()
+	m, byISBN := newDurableIndex()
+	d, err := multiindex.OpenDurable(dir, m, failingCodec{}, multiindex.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := Book{Name: "good", ISBN: "001"}
+	if ok, err := d.Insert(good); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	if _, err := d.Insert(Book{Name: "poison", ISBN: "002"}); !errors.Is(err, errPoison) {
+		t.Fatalf("got %v, want errPoison", err)
+	}
+	if got := durableContent(byISBN); !slices.Equal(got, []Book{good}) {
+		t.Fatalf("in memory: %v", got)
+	}
+	// the log is unusable until reopened
+	if ok, err := d.Insert(Book{Name: "later", ISBN: "003"}); ok || !errors.Is(err, errPoison) || m.Size() != 1 {
+		t.Fatalf("insert after a failure: %v, %v, size %d", ok, err, m.Size())
+	}
+	d.Close()
+
+	d, byISBN = openDurable(t, dir, multiindex.DurableOptions{})
+	defer d.Close()
+	if got := durableContent(byISBN); !slices.Equal(got, []Book{good}) {
+		t.Fatalf("reopened: %v", got)
+	}
+}
+
+func TestDurableErase(t *testing.T) {
+	l := newLibrary(t, multiindex.Restrict)
+	d, err := multiindex.OpenDurable(t.TempDir(), l.authors, multiindex.GobCodec[Author]{}, multiindex.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	var ce *multiindex.ConstraintError
+	if err := d.Erase(Author{Name: "Verne", Country: "FR"}); !errors.As(err, &ce) {
+		t.Errorf("restricted erase: %v", err)
+	}
+	if err := d.Erase(Author{Name: "Poe"}); !errors.Is(err, multiindex.ErrNotFound) {
+		t.Errorf("absent erase: %v", err)
+	}
+	if err := d.Erase(Author{Name: "Wells", Country: "UK"}); err != nil || l.authors.Size() != 1 {
+		t.Errorf("erase: %v, size %d", err, l.authors.Size())
+	}
+}
+
+// Durables of MultiIndexes tied by a foreign key replay their own records only,
+// whatever the order they are opened in
+func TestDurableForeignKeyRecovery(t *testing.T) {
+	authorsDir, booksDir := t.TempDir(), t.TempDir()
+	l := newLibrary(t, multiindex.Cascade)
+	da, err := multiindex.OpenDurable(authorsDir, l.authors, multiindex.GobCodec[Author]{}, multiindex.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := multiindex.OpenDurable(booksDir, l.books, multiindex.GobCodec[Book]{}, multiindex.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the books of Verne go with him, then he comes back with a new one
+	if err := da.Erase(Author{Name: "Verne", Country: "FR"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := da.Insert(Author{Name: "Verne", Country: "FR"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Insert(Book{Name: "Robur", Author: "Verne", ISBN: "004"}); err != nil {
+		t.Fatal(err)
+	}
+	da.Close()
+	db.Close()
+	want := []Book{{Name: "Anonymous", ISBN: "003"}, {Name: "Robur", Author: "Verne", ISBN: "004"}}
+
+	for _, booksFirst := range []bool{true, false} {
+		authors := multiindex.New[Author]()
+		byName := multiindex_container.NewOrderedUnique(func(a Author) string { return a.Name })
+		authors.AddIndex(byName)
+		books, byISBN := newDurableIndex()
+		_, err := multiindex.NewForeignKey("book author",
+			books, func(b Book) string { return b.Author },
+			authors, byName, func(a Author) string { return a.Name },
+			multiindex.ForeignKeyOptions[Book, string]{OnDelete: multiindex.Cascade})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		open := []func() error{
+			func() error {
+				d, err := multiindex.OpenDurable(authorsDir, authors, multiindex.GobCodec[Author]{}, multiindex.DurableOptions{})
+				if err == nil {
+					d.Close()
+				}
+				return err
+			},
+			func() error {
+				d, err := multiindex.OpenDurable(booksDir, books, multiindex.GobCodec[Book]{}, multiindex.DurableOptions{})
+				if err == nil {
+					d.Close()
+				}
+				return err
+			},
+		}
+		if booksFirst {
+			open[0], open[1] = open[1], open[0]
+		}
+		for _, f := range open {
+			if err := f(); err != nil {
+				t.Fatalf("books first %v: %v", booksFirst, err)
+			}
+		}
+		if got := durableContent(byISBN); !slices.Equal(got, want) || authors.Size() != 2 {
+			t.Errorf("books first %v: %v, %d authors", booksFirst, got, authors.Size())
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package multiindex_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type CacheEntry struct {
+	Key   string
+	Value int
+}
+
+func TestEviction(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		policy  multiindex.EvictionPolicy[CacheEntry]
+		evicted []string
+	}{
+		{"lru", multiindex.NewLRU[CacheEntry](), []string{"c", "b"}},
+		{"lfu", multiindex.NewLFU[CacheEntry](), []string{"c", "d"}},
+		{"fifo", multiindex.NewFIFO[CacheEntry](), []string{"a", "b"}},
+	} {
+		m := multiindex.New[CacheEntry]()
+		byKey := multiindex_container.NewNonOrderedUnique(func(e CacheEntry) string { return e.Key })
+		byValue := multiindex_container.NewOrderedNonUnique(func(e CacheEntry) int { return e.Value })
+		m.AddIndex(byKey, byValue)
+
+		var evicted []string
+		m.SetCapacity(3, tc.policy, func(e CacheEntry) { evicted = append(evicted, e.Key) })
+		m.Insert(CacheEntry{"a", 1})
+		m.Insert(CacheEntry{"b", 2})
+		m.Insert(CacheEntry{"c", 3})
+
+		byKey.Find("a")
+		byValue.Find(2)
+		byKey.Find("a")
+
+		m.Insert(CacheEntry{"d", 4})
+		m.Insert(CacheEntry{"e", 5})
+
+		if m.Size() != 3 {
+			t.Errorf("%s: size %d", tc.name, m.Size())
+		}
+		if len(evicted) != len(tc.evicted) || evicted[0] != tc.evicted[0] || evicted[1] != tc.evicted[1] {
+			t.Errorf("%s: evicted %v, expected %v", tc.name, evicted, tc.evicted)
+		}
+		for _, key := range evicted {
+			if byKey.Find(key).IsValid() {
+				t.Errorf("%s: %s is still indexed", tc.name, key)
+			}
+		}
+		if err := m.Verify(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
+
+func TestEvictionRestricted(t *testing.T) {
+	l := newLibrary(t, multiindex.Restrict)
+	var evicted []string
+	if err := l.authors.SetCapacity(2, multiindex.NewFIFO[Author](), func(a Author) { evicted = append(evicted, a.Name) }); err != nil {
+		t.Fatal(err)
+	}
+	var changes []multiindex.Change[Author]
+	l.authors.Observe(func(c multiindex.Change[Author]) { changes = append(changes, c) })
+
+	// Verne, the oldest, has books: the next victim is evicted instead
+	if err := l.authors.TryInsert(Author{Name: "Poe"}); err != nil {
+		t.Fatal(err)
+	}
+	if l.authors.Size() != 2 || len(evicted) != 1 || evicted[0] != "Wells" {
+		t.Fatalf("size %d, evicted %v", l.authors.Size(), evicted)
+	}
+
+	// no element can be evicted: the insert is rejected, unseen by observers
+	l.books.Insert(Book{Name: "Raven", Author: "Poe", ISBN: "004"})
+	changes = nil
+	for _, name := range []string{"Twain", "Dumas"} {
+		if err := l.authors.TryInsert(Author{Name: name}); !errors.Is(err, multiindex.ErrNoRoom) {
+			t.Fatalf("insert %s: got %v, want ErrNoRoom", name, err)
+		}
+		if l.authors.Size() != 2 || l.byName.Find(name).IsValid() {
+			t.Fatalf("insert %s: size %d", name, l.authors.Size())
+		}
+	}
+	if len(changes) != 0 || len(evicted) != 1 {
+		t.Fatalf("changes %v, evicted %v", changes, evicted)
+	}
+
+	// the failed inserts left the eviction order alone: Verne is still first
+	l.books.Erase(Book{Name: "Nautilus", Author: "Verne", ISBN: "001"})
+	l.books.Erase(Book{Name: "Balloon", Author: "Verne", ISBN: "002"})
+	l.books.Erase(Book{Name: "Raven", Author: "Poe", ISBN: "004"})
+	if !l.authors.Insert(Author{Name: "Twain"}) {
+		t.Fatal("insert failed once Verne has no books")
+	}
+	if l.authors.Size() != 2 || len(evicted) != 2 || evicted[1] != "Verne" {
+		t.Fatalf("size %d, evicted %v", l.authors.Size(), evicted)
+	}
+	if err := l.authors.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvictionSetCapacityRestricted(t *testing.T) {
+	l := newLibrary(t, multiindex.Restrict)
+	l.books.Insert(Book{Name: "Time Machine", Author: "Wells", ISBN: "004"})
+	if err := l.authors.SetCapacity(1, multiindex.NewLRU[Author](), nil); !errors.Is(err, multiindex.ErrNoRoom) {
+		t.Fatalf("got %v, want ErrNoRoom", err)
+	}
+	// no capacity was set
+	if !l.authors.Insert(Author{Name: "Poe"}) || l.authors.Size() != 3 {
+		t.Fatalf("size %d", l.authors.Size())
+	}
+}
+
+func TestEvictionAccesses(t *testing.T) {
+	m := multiindex.New[CacheEntry]()
+	byKey := multiindex_container.NewNonOrderedUnique(func(e CacheEntry) string { return e.Key })
+	byValue := multiindex_container.NewOrderedNonUnique(func(e CacheEntry) int { return e.Value })
+	m.AddIndex(byKey, byValue)
+	var evicted []string
+	m.SetCapacity(3, multiindex.NewLRU[CacheEntry](), func(e CacheEntry) { evicted = append(evicted, e.Key) })
+	m.Insert(CacheEntry{"a", 1})
+	m.Insert(CacheEntry{"b", 2})
+	m.Insert(CacheEntry{"c", 3})
+
+	// Where and queries count as accesses, traversals do not
+	for range byValue.Where(1) {
+	}
+	for range m.Query().Where(byKey, multiindex.Eq("b")).All() {
+	}
+	byValue.TraversalValue(func(CacheEntry) bool { return true })
+
+	m.Insert(CacheEntry{"d", 4})
+	if len(evicted) != 1 || evicted[0] != "c" {
+		t.Fatalf("evicted %v, expected [c]", evicted)
+	}
+}
+
+func TestEvictionZeroCapacity(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("capacity 0 accepted")
+		}
+	}()
+	m := multiindex.New[CacheEntry]()
+	m.AddIndex(multiindex_container.NewNonOrderedUnique(func(e CacheEntry) string { return e.Key }))
+	m.SetCapacity(0, multiindex.NewLRU[CacheEntry](), nil)
+}
@@ -0,0 +1,111 @@
+package multiindex_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type Session struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	ticks chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.ticks
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+	c.ticks <- now
+}
+
+func TestExpiry(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := multiindex.New[Session]()
+	byID := multiindex_container.NewNonOrderedUnique(func(s Session) string { return s.ID })
+	byExpiry := multiindex_container.NewExpiry(func(s Session) time.Time { return s.ExpiresAt })
+	m.AddIndex(byID, byExpiry)
+
+	m.Insert(Session{ID: "a", ExpiresAt: start.Add(1 * time.Minute)})
+	m.Insert(Session{ID: "b", ExpiresAt: start.Add(2 * time.Minute)})
+	m.Insert(Session{ID: "c", ExpiresAt: start.Add(3 * time.Minute)})
+	m.Insert(Session{ID: "d", ExpiresAt: start.Add(10 * time.Minute)})
+
+	expired := m.ExpireBefore(start.Add(2 * time.Minute))
+	if len(expired) != 1 || expired[0].ID != "a" {
+		t.Errorf("expired: %v", expired)
+	}
+	if next, _ := byExpiry.NextExpiry(); !next.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("next expiry: %v", next)
+	}
+
+	var mu sync.Mutex
+	clock := &fakeClock{now: start, ticks: make(chan time.Time)}
+	evicted := make(chan Session, 10)
+	stop := m.StartJanitor(clock, time.Minute, &mu, func(s Session) { evicted <- s })
+
+	clock.Advance(5 * time.Minute)
+	for _, id := range []string{"b", "c"} {
+		if s := <-evicted; s.ID != id {
+			t.Errorf("evicted %v, expected %s", s, id)
+		}
+	}
+	stop()
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if m.Size() != 1 || !byID.Find("d").IsValid() {
+		t.Errorf("size: %d", m.Size())
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestExpiryOutOfNanosecondRange(t *testing.T) {
+	m := multiindex.New[Session]()
+	byExpiry := multiindex_container.NewExpiry(func(s Session) time.Time { return s.ExpiresAt })
+	m.AddIndex(multiindex_container.NewNonOrderedUnique(func(s Session) string { return s.ID }), byExpiry)
+
+	m.Insert(Session{ID: "far", ExpiresAt: time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	m.Insert(Session{ID: "zero"})
+	m.Insert(Session{ID: "soon", ExpiresAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if next, _ := byExpiry.NextExpiry(); !next.IsZero() {
+		t.Errorf("next expiry: %v", next)
+	}
+
+	expired := m.ExpireBefore(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(expired) != 2 || expired[0].ID != "zero" || expired[1].ID != "soon" {
+		t.Errorf("expired: %v", expired)
+	}
+	if m.Size() != 1 {
+		t.Fatalf("size: %d", m.Size())
+	}
+	if expired := m.ExpireBefore(time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)); len(expired) != 0 {
+		t.Errorf("expired: %v", expired)
+	}
+	if expired := m.ExpireBefore(time.Date(3001, 1, 1, 0, 0, 0, 0, time.UTC)); len(expired) != 1 {
+		t.Errorf("expired: %v", expired)
+	}
+}
@@ -0,0 +1,127 @@
+package multiindex_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+func TestFilter(t *testing.T) {
+	m := multiindex.New[Book]()
+	unpublished := multiindex_container.NewNonOrderedUnique(func(b Book) string { return b.Name })
+	byISBN := multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN })
+	// the partial index goes first: it must not be taken for the primary one
+	m.AddIndex(
+		multiindex_container.Filter(unpublished, func(b Book) bool { return b.PublushedAt.IsZero() }),
+		byISBN,
+	)
+
+	draft := Book{Name: "Draft", ISBN: "1"}
+	published1 := Book{Name: "Published", ISBN: "2", PublushedAt: time.Unix(1, 0)}
+	published2 := Book{Name: "Published", ISBN: "3", PublushedAt: time.Unix(2, 0)}
+
+	for _, b := range []Book{draft, published1, published2} {
+		if !m.Insert(b) {
+			t.Errorf("not inserted: %v", b)
+		}
+	}
+	if m.Size() != 3 || unpublished.Size() != 1 {
+		t.Errorf("size: %d, %d", m.Size(), unpublished.Size())
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	// moves in
+	draft2 := published2
+	draft2.PublushedAt = time.Time{}
+	if !m.Modify(published2, draft2) {
+		t.Errorf("not modified")
+	}
+	if it := unpublished.Find("Published"); !it.IsValid() || it.Value() != draft2 {
+		t.Errorf("not moved in")
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	// conflicts inside the partial index are still rejected and rolled back
+	draft3 := published1
+	draft3.PublushedAt = time.Time{}
+	if m.Modify(published1, draft3) {
+		t.Errorf("duplicate name in partial index")
+	}
+	if !m.Contains(published1) || m.Contains(draft3) {
+		t.Errorf("not restored")
+	}
+
+	// moves out
+	if !m.Modify(draft, Book{Name: "Draft", ISBN: "1", PublushedAt: time.Unix(3, 0)}) {
+		t.Errorf("not modified")
+	}
+	if unpublished.Find("Draft").IsValid() {
+		t.Errorf("not moved out")
+	}
+
+	m.Erase(published1)
+	if m.Size() != 2 || unpublished.Size() != 1 {
+		t.Errorf("size: %d, %d", m.Size(), unpublished.Size())
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestFilterOnly(t *testing.T) {
+	m := multiindex.New[Book]()
+	m.AddIndex(multiindex_container.Filter(
+		multiindex_container.NewNonOrderedUnique(func(b Book) string { return b.Name }),
+		func(b Book) bool { return b.PublushedAt.IsZero() },
+	))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("insert accepted without an index holding all elements")
+		}
+	}()
+	m.Insert(Book{Name: "Published", PublushedAt: time.Unix(1, 0)})
+}
+
+func TestSparse(t *testing.T) {
+	m := multiindex.New[Book]()
+	byName := multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Name })
+	byISBN := multiindex_container.NewSparseNonOrderedUnique(func(b Book) (string, bool) { return b.ISBN, b.ISBN != "" })
+	byISBNOrdered := multiindex_container.NewSparseOrderedNonUnique(func(b Book) (string, bool) { return b.ISBN, b.ISBN != "" })
+	m.AddIndex(byISBN, byISBNOrdered, byName)
+
+	noISBN1 := Book{Name: "Manuscript 1"}
+	noISBN2 := Book{Name: "Manuscript 2"}
+	withISBN := Book{Name: "Book", ISBN: "9780000001"}
+	for _, b := range []Book{noISBN1, noISBN2, withISBN} {
+		if !m.Insert(b) {
+			t.Errorf("not inserted: %v", b)
+		}
+	}
+	if m.Insert(Book{Name: "Book, reprint", ISBN: "9780000001"}) {
+		t.Errorf("duplicate ISBN inserted")
+	}
+	if m.Size() != 3 || byISBN.Size() != 1 || byISBNOrdered.Size() != 1 {
+		t.Errorf("size: %d, %d, %d", m.Size(), byISBN.Size(), byISBNOrdered.Size())
+	}
+	if it := byISBN.Index.Find(withISBN.ISBN); !it.IsValid() || it.Value() != withISBN {
+		t.Errorf("not found")
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+
+	m.Erase(noISBN1)
+	m.Erase(withISBN)
+	if m.Size() != 1 || byISBN.Size() != 0 || byISBNOrdered.Size() != 0 {
+		t.Errorf("size: %d, %d, %d", m.Size(), byISBN.Size(), byISBNOrdered.Size())
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package multiindex_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type Author struct {
+	Name    string
+	Country string
+}
+
+type library struct {
+	authors  *multiindex.MultiIndex[Author]
+	byName   *multiindex_container.MultiIndexByOrderedUnique[string, Author]
+	books    *multiindex.MultiIndex[Book]
+	byAuthor *multiindex_container.MultiIndexByNonOrderedNonUnique[string, Book]
+	fk       *multiindex.ForeignKey[Book, Author, string]
+}
+
+func newLibrary(t *testing.T, onDelete multiindex.OnDelete) *library {
+	t.Helper()
+	l := &library{
+		authors:  multiindex.New[Author](),
+		byName:   multiindex_container.NewOrderedUnique(func(a Author) string { return a.Name }),
+		books:    multiindex.New[Book](),
+		byAuthor: multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Author }),
+	}
+	l.authors.AddIndex(l.byName)
+	l.books.AddIndex(multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN }), l.byAuthor)
+	l.authors.Insert(Author{Name: "Verne", Country: "FR"})
+	l.authors.Insert(Author{Name: "Wells", Country: "UK"})
+	l.books.Insert(Book{Name: "Nautilus", Author: "Verne", ISBN: "001"})
+	l.books.Insert(Book{Name: "Balloon", Author: "Verne", ISBN: "002"})
+	l.books.Insert(Book{Name: "Anonymous", ISBN: "003"})
+
+	fk, err := multiindex.NewForeignKey("book author",
+		l.books, func(b Book) string { return b.Author },
+		l.authors, l.byName, func(a Author) string { return a.Name },
+		multiindex.ForeignKeyOptions[Book, string]{
+			OnDelete:   onDelete,
+			SetNull:    func(b Book) Book { b.Author = ""; return b },
+			ChildIndex: l.byAuthor,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.fk = fk
+	return l
+}
+
+func TestForeignKey(t *testing.T) {
+	l := newLibrary(t, multiindex.Restrict)
+	var cerr *multiindex.ConstraintError
+	if err := l.books.TryInsert(Book{Name: "Time Machine", Author: "Orwell", ISBN: "004"}); !errors.As(err, &cerr) || cerr.Constraint != "book author" {
+		t.Fatalf("orphan inserted: %v", err)
+	}
+	if err := l.books.TryInsert(Book{Name: "Time Machine", Author: "Wells", ISBN: "004"}); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := l.fk.Parent(Book{Author: "Wells"}); !ok || p.Country != "UK" {
+		t.Fatalf("Parent: %v, %v", p, ok)
+	}
+	if _, ok := l.fk.Parent(Book{Name: "Anonymous", ISBN: "003"}); ok {
+		t.Fatal("parent of a book without author")
+	}
+
+	verne := Author{Name: "Verne", Country: "FR"}
+	if err := l.authors.TryErase(verne); !errors.As(err, &cerr) {
+		t.Fatalf("referenced author erased: %v", err)
+	}
+	if l.authors.Modify(verne, Author{Name: "J. Verne", Country: "FR"}) {
+		t.Fatal("key of a referenced author modified")
+	}
+	if !l.authors.Modify(verne, Author{Name: "Verne", Country: "France"}) {
+		t.Fatal("Modify keeping the key failed")
+	}
+	if err := l.authors.TryErase(Author{Name: "Wells", Country: "UK"}); err == nil {
+		t.Fatal("referenced author erased")
+	}
+	l.books.Erase(Book{Name: "Time Machine", Author: "Wells", ISBN: "004"})
+	if err := l.authors.TryErase(Author{Name: "Wells", Country: "UK"}); err != nil {
+		t.Fatal(err)
+	}
+
+	l.fk.Close()
+	if !l.books.Insert(Book{Name: "1984", Author: "Orwell", ISBN: "005"}) {
+		t.Fatal("insert refused after Close")
+	}
+	if _, err := multiindex.NewForeignKey("book author",
+		l.books, func(b Book) string { return b.Author },
+		l.authors, l.byName, func(a Author) string { return a.Name },
+		multiindex.ForeignKeyOptions[Book, string]{}); !errors.As(err, &cerr) {
+		t.Fatalf("foreign key added over orphans: %v", err)
+	}
+}
+
+func TestForeignKeyOnDelete(t *testing.T) {
+	verne := Author{Name: "Verne", Country: "FR"}
+	books := func(l *library) []Book {
+		var res []Book
+		l.books.MultiIndexBy[0].TraversalValue(func(b Book) bool {
+			res = append(res, b)
+			return true
+		})
+		return res
+	}
+
+	l := newLibrary(t, multiindex.Cascade)
+	if err := l.authors.TryErase(verne); err != nil {
+		t.Fatal(err)
+	}
+	if got := books(l); !slices.Equal(got, []Book{{Name: "Anonymous", ISBN: "003"}}) {
+		t.Fatalf("after cascade: %v", got)
+	}
+
+	l = newLibrary(t, multiindex.SetNull)
+	if err := l.authors.TryErase(verne); err != nil {
+		t.Fatal(err)
+	}
+	want := []Book{{Name: "Nautilus", ISBN: "001"}, {Name: "Balloon", ISBN: "002"}, {Name: "Anonymous", ISBN: "003"}}
+	if got := books(l); !slices.Equal(got, want) {
+		t.Fatalf("after set null: %v", got)
+	}
+	if l.authors.Size() != 1 {
+		t.Fatalf("%d authors left", l.authors.Size())
+	}
+}
+
+func TestForeignKeyRestrictAfterCascade(t *testing.T) {
+	type review struct {
+		Author string
+		Text   string
+	}
+	l := newLibrary(t, multiindex.Cascade)
+	reviews := multiindex.New[review]()
+	reviews.AddIndex(multiindex_container.NewOrderedUnique(func(r review) string { return r.Text }))
+	reviews.Insert(review{Author: "Verne", Text: "great"})
+	if _, err := multiindex.NewForeignKey("review author",
+		reviews, func(r review) string { return r.Author },
+		l.authors, l.byName, func(a Author) string { return a.Name },
+		multiindex.ForeignKeyOptions[review, string]{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cascade of the first foreign key must not run when the second one restricts
+	var cerr *multiindex.ConstraintError
+	if err := l.authors.TryErase(Author{Name: "Verne", Country: "FR"}); !errors.As(err, &cerr) || cerr.Constraint != "review author" {
+		t.Fatalf("got %v, want a violation of review author", err)
+	}
+	if l.books.Size() != 3 || l.authors.Size() != 2 {
+		t.Fatalf("%d books, %d authors after a restricted erase", l.books.Size(), l.authors.Size())
+	}
+
+	// restricted one level down: books of the author are reviewed
+	bookReviews := multiindex.New[review]()
+	bookReviews.AddIndex(multiindex_container.NewOrderedUnique(func(r review) string { return r.Text }))
+	bookReviews.Insert(review{Author: "002", Text: "fine"})
+	if _, err := multiindex.NewForeignKey("book review",
+		bookReviews, func(r review) string { return r.Author },
+		l.books, l.books.MultiIndexBy[0].(multiindex.KeyFinder[string, Book]), func(b Book) string { return b.ISBN },
+		multiindex.ForeignKeyOptions[review, string]{}); err != nil {
+		t.Fatal(err)
+	}
+	reviews.Erase(review{Author: "Verne", Text: "great"})
+	if err := l.authors.TryErase(Author{Name: "Verne", Country: "FR"}); !errors.As(err, &cerr) || cerr.Constraint != "book review" {
+		t.Fatalf("got %v, want a violation of book review", err)
+	}
+	if l.books.Size() != 3 {
+		t.Fatalf("%d books after a restricted cascade", l.books.Size())
+	}
+	if err := l.books.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
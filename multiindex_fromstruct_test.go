@@ -0,0 +1,178 @@
+package multiindex_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type TaggedBook struct {
+	ISBN        string    `mi:"isbn,unique,hashed"`
+	Author      string    `mi:"author,ordered;author_name,unique"`
+	Name        string    `mi:"author_name"`
+	PublishedAt time.Time `mi:"published,ordered"`
+	Pages       int
+}
+
+func TestFromStruct(t *testing.T) {
+	m, indexes, err := multiindex_container.FromStruct[TaggedBook]()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if names := indexes.Names(); len(names) != 4 || names[0] != "isbn" || names[3] != "published" {
+		t.Errorf("names: %v", names)
+	}
+
+	books := []TaggedBook{
+		{ISBN: "1", Author: "Jules Verne", Name: "Around the World in Eighty Days", PublishedAt: time.Date(1872, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ISBN: "2", Author: "Herbert George Wells", Name: "The Time Machine", PublishedAt: time.Date(1895, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ISBN: "3", Author: "Herbert George Wells", Name: "The Invisible Man", PublishedAt: time.Date(1897, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, b := range books {
+		if !m.Insert(b) {
+			t.Errorf("not inserted: %v", b)
+		}
+	}
+	if m.Insert(TaggedBook{ISBN: "1"}) {
+		t.Errorf("duplicate ISBN inserted")
+	}
+	if m.Insert(TaggedBook{ISBN: "4", Author: "Herbert George Wells", Name: "The Time Machine"}) {
+		t.Errorf("duplicate composite key inserted")
+	}
+
+	if it := indexes.Find("isbn", "2"); !it.IsValid() || it.Value() != books[1] {
+		t.Errorf("Find by isbn")
+	}
+	if it := indexes.Find("author_name", "Herbert George Wells", "The Invisible Man"); !it.IsValid() || it.Value() != books[2] {
+		t.Errorf("Find by composite key")
+	}
+	cnt := 0
+	for range indexes.Where("author", "Herbert George Wells") {
+		cnt++
+	}
+	if cnt != 2 {
+		t.Errorf("Where by author: %d", cnt)
+	}
+
+	var years []int
+	byDate := indexes.Index("published").(*multiindex_container.MultiIndexByOrderedNonUnique[string, TaggedBook])
+	for _, b := range byDate.All() {
+		years = append(years, b.PublishedAt.Year())
+	}
+	if len(years) != 3 || years[0] != 1872 || years[2] != 1897 {
+		t.Errorf("order by date: %v", years)
+	}
+
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	ordered := [][]any{
+		{-5, "b"},
+		{0, ""},
+		{0, "a"},
+		{0, "a\x00"},
+		{0, "ab"},
+		{3, "a"},
+	}
+	encode := func(parts ...any) string {
+		t.Helper()
+		key, err := multiindex_container.EncodeKey(parts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	for i := 1; i < len(ordered); i++ {
+		if encode(ordered[i-1]...) >= encode(ordered[i]...) {
+			t.Errorf("%v >= %v", ordered[i-1], ordered[i])
+		}
+	}
+	if encode(-1.5) >= encode(3.5) || encode(math.Inf(1)) >= encode(math.NaN()) {
+		t.Errorf("floats are not ordered")
+	}
+	if encode(math.Copysign(0, -1)) != encode(0.0) || encode(math.NaN()) != encode(-math.NaN()) {
+		t.Errorf("equal floats are encoded differently")
+	}
+	if encode(3) != encode(uint(3)) || encode(int8(-1)) >= encode(uint64(0)) || encode(uint64(1<<63)) <= encode(int64(1<<62)) {
+		t.Errorf("signed and unsigned integers are not encoded alike")
+	}
+
+	times := []time.Time{
+		{},
+		time.Date(1600, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1970, 1, 1, 0, 0, 0, 1, time.UTC),
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for i := 1; i < len(times); i++ {
+		if encode(times[i-1]) >= encode(times[i]) {
+			t.Errorf("%v >= %v", times[i-1], times[i])
+		}
+	}
+
+	if _, err := multiindex_container.EncodeKey(nil); err == nil {
+		t.Errorf("nil encoded")
+	}
+	if _, err := multiindex_container.EncodeKey([]int{1}); err == nil {
+		t.Errorf("slice encoded")
+	}
+}
+
+func TestFromStructKeyTypes(t *testing.T) {
+	type item struct {
+		ID    uint    `mi:"id,unique"`
+		Price float64 `mi:"price,ordered"`
+	}
+	m, indexes, err := multiindex_container.FromStruct[item]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Insert(item{ID: 3, Price: 2})
+	if it := indexes.Find("id", 3); it == nil || !it.IsValid() {
+		t.Errorf("int key does not match a uint field")
+	}
+	if it := indexes.Find("price", 2); it == nil || !it.IsValid() {
+		t.Errorf("int key does not match a float field")
+	}
+	if it := indexes.Find("id", nil); it != nil && it.IsValid() {
+		t.Errorf("nil key matched")
+	}
+	if _, err := indexes.EncodeKey("id", 1, 2); err == nil {
+		t.Errorf("too many key fields encoded")
+	}
+	if !m.Insert(item{ID: 4, Price: math.Copysign(0, -1)}) {
+		t.Errorf("-0 rejected")
+	}
+	if it := indexes.Find("price", 0.0); it == nil || !it.IsValid() || it.Value().ID != 4 {
+		t.Errorf("0 does not match -0")
+	}
+}
+
+func TestFromStructPointer(t *testing.T) {
+	m, indexes, err := multiindex_container.FromStruct[*TaggedBook]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ce *multiindex.ConstraintError
+	if err := m.TryInsert(nil); !errors.As(err, &ce) {
+		t.Errorf("nil inserted: %v", err)
+	}
+	if m.Contains(nil) || m.Size() != 0 {
+		t.Errorf("nil element indexed")
+	}
+	b := &TaggedBook{ISBN: "1", Author: "Verne", Name: "Nautilus"}
+	if !m.Insert(b) {
+		t.Fatal("insert failed")
+	}
+	if it := indexes.Find("isbn", "1"); it == nil || !it.IsValid() || it.Value() != b {
+		t.Errorf("Find by pointer element failed")
+	}
+}
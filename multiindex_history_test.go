@@ -0,0 +1,116 @@
+package multiindex_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+)
+
+func TestHistory(t *testing.T) {
+	m, byISBN := newDurableIndex()
+	h := multiindex.NewHistory(m, 0)
+	defer h.Close()
+
+	a := Book{Name: "a", ISBN: "001"}
+	b := Book{Name: "b", ISBN: "002"}
+	a2 := Book{Name: "a", Author: "Verne", ISBN: "001"}
+	m.Insert(a)
+	h.Checkpoint("start")
+	m.Insert(b)
+	m.Modify(a, a2)
+	m.Erase(b)
+	if h.CanUndo() != 4 {
+		t.Fatalf("CanUndo %d", h.CanUndo())
+	}
+
+	steps := [][]Book{{a2, b}, {a, b}, {a}}
+	for _, want := range steps {
+		if err := h.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if got := durableContent(byISBN); !slices.Equal(got, want) {
+			t.Fatalf("after Undo: %v, want %v", got, want)
+		}
+	}
+	if err := h.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	h.Checkpoint("b")
+	if err := h.UndoTo("start"); err != nil {
+		t.Fatal(err)
+	}
+	if got := durableContent(byISBN); !slices.Equal(got, []Book{a}) {
+		t.Fatalf("after UndoTo: %v", got)
+	}
+	if err := h.RedoTo("b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := durableContent(byISBN); !slices.Equal(got, []Book{a, b}) {
+		t.Fatalf("after RedoTo: %v", got)
+	}
+
+	// a new change discards the undone ones
+	h.Undo()
+	m.Insert(Book{Name: "c", ISBN: "003"})
+	if err := h.Redo(); !errors.Is(err, multiindex.ErrNoHistory) {
+		t.Fatalf("Redo after a change: %v", err)
+	}
+	if err := h.RedoTo("b"); !errors.Is(err, multiindex.ErrUnknownCheckpoint) {
+		t.Fatalf("RedoTo a discarded checkpoint: %v", err)
+	}
+	for h.CanUndo() > 0 {
+		h.Undo()
+	}
+	if m.Size() != 0 {
+		t.Fatalf("%d elements left", m.Size())
+	}
+	if err := h.Undo(); !errors.Is(err, multiindex.ErrNoHistory) {
+		t.Fatalf("Undo of nothing: %v", err)
+	}
+}
+
+func TestHistoryDepth(t *testing.T) {
+	m, byISBN := newDurableIndex()
+	h := multiindex.NewHistory(m, 3)
+	defer h.Close()
+
+	h.Checkpoint("empty")
+	for i := 0; i < 5; i++ {
+		m.Insert(Book{Name: fmt.Sprint(i), ISBN: fmt.Sprintf("%03d", i)})
+	}
+	if h.CanUndo() != 3 {
+		t.Fatalf("CanUndo %d", h.CanUndo())
+	}
+	if err := h.UndoTo("empty"); !errors.Is(err, multiindex.ErrUnknownCheckpoint) {
+		t.Fatalf("UndoTo a dropped checkpoint: %v", err)
+	}
+	for h.CanUndo() > 0 {
+		h.Undo()
+	}
+	if byISBN.Size() != 2 {
+		t.Fatalf("%d elements left", byISBN.Size())
+	}
+}
+
+func TestHistoryAtomic(t *testing.T) {
+	m, byISBN := newDurableIndex()
+	h := multiindex.NewHistory(m, 0)
+	defer h.Close()
+
+	a := Book{Name: "a", ISBN: "001"}
+	h.Checkpoint("empty")
+	m.Insert(a)
+	m.Insert(Book{Name: "b", ISBN: "002"})
+	h.Close()
+	// unrecorded: undoing the insertion of `a` now fails
+	m.Erase(a)
+	if err := h.UndoTo("empty"); !errors.Is(err, multiindex.ErrNotFound) {
+		t.Fatalf("UndoTo: %v", err)
+	}
+	if got := durableContent(byISBN); !slices.Equal(got, []Book{{Name: "b", ISBN: "002"}}) {
+		t.Fatalf("partial undo: %v", got)
+	}
+}
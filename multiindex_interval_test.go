@@ -0,0 +1,72 @@
+package multiindex_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type Booking struct {
+	ID    int
+	Start int
+	End   int
+}
+
+func TestInterval(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+
+	m := multiindex.New[Booking]()
+	byID := multiindex_container.NewNonOrderedUnique(func(b Booking) int { return b.ID })
+	byTime := multiindex_container.NewInterval(func(b Booking) (int, int) { return b.Start, b.End })
+	m.AddIndex(byTime, byID)
+
+	bookings := make(map[int]Booking)
+	for i := 0; i < 1000; i++ {
+		start := rnd.Intn(1000)
+		b := Booking{ID: i, Start: start, End: start + rnd.Intn(50)}
+		m.Insert(b)
+		bookings[i] = b
+	}
+	for i := 0; i < 1000; i += 3 {
+		m.Erase(bookings[i])
+		delete(bookings, i)
+	}
+	if err := m.Verify(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if m.Insert(Booking{ID: -1, Start: 10, End: 5}) {
+		t.Errorf("reversed range inserted")
+	}
+
+	id := func(b Booking) int { return b.ID }
+	for q := 0; q < 100; q++ {
+		lo := rnd.Intn(1000)
+		hi := lo + rnd.Intn(30)
+
+		overlapping := collectIDs(byTime.Overlapping(lo, hi), id)
+		containing := collectIDs(byTime.Containing(lo), id)
+		other := rnd.Intn(1000)
+		stabbed := collectIDs(byTime.Stabbing(lo, other, lo), id)
+		for _, b := range bookings {
+			if (b.Start < hi && lo < b.End) != overlapping[b.ID] {
+				t.Errorf("Overlapping(%d, %d): mismatch on %v", lo, hi, b)
+			}
+			if (b.Start <= lo && lo < b.End) != containing[b.ID] {
+				t.Errorf("Containing(%d): mismatch on %v", lo, b)
+			}
+			if (b.Start <= lo && lo < b.End || b.Start <= other && other < b.End) != stabbed[b.ID] {
+				t.Errorf("Stabbing(%d, %d): mismatch on %v", lo, other, b)
+			}
+		}
+		n := 0
+		for range byTime.Stabbing(lo, other, lo) {
+			n++
+		}
+		if n != len(stabbed) {
+			t.Errorf("Stabbing(%d, %d): %d results for %d elements", lo, other, n, len(stabbed))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package multiindex_test
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+// allOnly hides all methods of an index but All, to force a hash join
+type allOnly[K, V comparable] struct {
+	idx multiindex.JoinIndex[K, V]
+}
+
+func (a allOnly[K, V]) All() iter.Seq2[K, V] {
+	return a.idx.All()
+}
+
+func joined[L, R comparable](seq iter.Seq2[L, R]) []string {
+	var res []string
+	for l, r := range seq {
+		res = append(res, fmt.Sprint(l, r))
+	}
+	return res
+}
+
+func TestJoin(t *testing.T) {
+	books := []Book{
+		{Name: "Nautilus", Author: "Verne", ISBN: "001"},
+		{Name: "Balloon", Author: "Verne", ISBN: "002"},
+		{Name: "Time Machine", Author: "Wells", ISBN: "003"},
+		{Name: "1984", Author: "Orwell", ISBN: "004"},
+	}
+	orderedBooks := multiindex_container.NewOrderedNonUnique(func(b Book) string { return b.Author })
+	hashedBooks := multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Author })
+	mb := multiindex.New[Book]()
+	mb.AddIndex(multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN }), orderedBooks, hashedBooks)
+	for _, b := range books {
+		mb.Insert(b)
+	}
+
+	authors := []Author{{"Asimov", "US"}, {"Verne", "FR"}, {"Wells", "UK"}}
+	orderedAuthors := multiindex_container.NewOrderedUnique(func(a Author) string { return a.Name })
+	hashedAuthors := multiindex_container.NewNonOrderedUnique(func(a Author) string { return a.Name })
+	ma := multiindex.New[Author]()
+	ma.AddIndex(orderedAuthors, hashedAuthors)
+	for _, a := range authors {
+		ma.Insert(a)
+	}
+
+	inner := []string{
+		fmt.Sprint(books[0], authors[1]),
+		fmt.Sprint(books[1], authors[1]),
+		fmt.Sprint(books[2], authors[2]),
+	}
+	outer := append(slices.Clone(inner), fmt.Sprint(books[3], Author{}))
+
+	for name, right := range map[string]multiindex.JoinIndex[string, Author]{
+		"merge":  orderedAuthors,
+		"lookup": hashedAuthors,
+		"hash":   allOnly[string, Author]{orderedAuthors},
+	} {
+		got := joined(multiindex.Join(orderedBooks, right))
+		if !slices.Equal(got, inner) {
+			t.Errorf("%s: Join = %v, want %v", name, got, inner)
+		}
+		got = joined(multiindex.LeftJoin(orderedBooks, right))
+		slices.Sort(got)
+		want := slices.Sorted(slices.Values(outer))
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: LeftJoin = %v, want %v", name, got, want)
+		}
+	}
+
+	// from a hashed side, in any order
+	got := joined(multiindex.LeftJoin(hashedBooks, orderedAuthors))
+	slices.Sort(got)
+	if want := slices.Sorted(slices.Values(outer)); !slices.Equal(got, want) {
+		t.Errorf("hashed left: %v, want %v", got, want)
+	}
+
+	// authors with their books: several matches per left element
+	got = joined(multiindex.LeftJoin(orderedAuthors, orderedBooks))
+	want := []string{
+		fmt.Sprint(authors[0], Book{}),
+		fmt.Sprint(authors[1], books[0]),
+		fmt.Sprint(authors[1], books[1]),
+		fmt.Sprint(authors[2], books[2]),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("authors with books: %v, want %v", got, want)
+	}
+
+	// stopping early
+	for range multiindex.Join(orderedBooks, orderedAuthors) {
+		break
+	}
+}
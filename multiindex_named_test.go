@@ -0,0 +1,54 @@
+package multiindex_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+func TestNamedIndex(t *testing.T) {
+	m := multiindex.New[Book]()
+	byISBN := multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN })
+	byName := multiindex_container.NewNonOrderedUnique(func(b Book) string { return b.Name })
+	m.AddIndex(byISBN)
+	if err := m.AddNamedIndex("name", byName); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddNamedIndex("name", byName); err == nil {
+		t.Errorf("duplicate name accepted")
+	}
+	if m.Index("name") != multiindex.MultiIndexByI[Book](byName) || m.Index("isbn") != nil {
+		t.Errorf("Index")
+	}
+	if m.IndexName(0) != "0" || m.IndexName(1) != "name" {
+		t.Errorf("IndexName: %s, %s", m.IndexName(0), m.IndexName(1))
+	}
+
+	if err := m.TryInsert(Book{Name: "A", ISBN: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	err := m.TryInsert(Book{Name: "A", ISBN: "2"})
+	var ie *multiindex.IndexError
+	if !errors.As(err, &ie) || ie.Index != "name" || !errors.Is(err, multiindex.ErrRejected) {
+		t.Errorf("TryInsert: %v", err)
+	}
+	if m.Size() != 1 {
+		t.Errorf("not rolled back")
+	}
+
+	var sb strings.Builder
+	if err := m.Dump(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "index name (") {
+		t.Errorf("Dump: %s", sb.String())
+	}
+
+	byName.Container[""] = Book{}
+	if err := m.Verify(); err == nil || !strings.Contains(err.Error(), "at name") {
+		t.Errorf("Verify: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package multiindex_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+func TestParseQuery(t *testing.T) {
+	x := newQueryIndexes()
+
+	q, err := x.m.ParseQuery(`author = "Wells" and date >= 40 ORDER BY isbn DESC LIMIT 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := slices.Collect(q.All())
+	expected := slices.Collect(x.m.Query().
+		Where(x.byAuthor, multiindex.Eq("Wells")).
+		Where(x.byDate, multiindex.Ge(int64(40))).
+		OrderByDesc(x.byISBN).
+		Limit(3).
+		All())
+	if len(res) != 3 || !slices.Equal(res, expected) || res[0].ISBN < res[1].ISBN {
+		t.Errorf("%v != %v", res, expected)
+	}
+
+	q, err = x.m.ParseQuery(`date BETWEEN 10 AND 11`)
+	if err != nil || len(slices.Collect(q.All())) != 4 {
+		t.Errorf("BETWEEN: %v", err)
+	}
+	q, err = x.m.ParseQuery(``)
+	if err != nil || len(slices.Collect(q.All())) != 100 {
+		t.Errorf("empty: %v", err)
+	}
+}
+
+func TestParseQueryTime(t *testing.T) {
+	m := multiindex.New[Book]()
+	m.AddNamedIndex("published", multiindex_container.NewExpiry(func(b Book) time.Time { return b.PublushedAt }))
+	m.Insert(Book{Name: "old", PublushedAt: time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)})
+	m.Insert(Book{Name: "new", PublushedAt: time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)})
+
+	for _, s := range []string{`published >= 2020-01-01`, `published > 2020-05-01T11:00:00Z`, `published = 2020-05-01T14:00+02:00`} {
+		q, err := m.ParseQuery(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := slices.Collect(q.All())
+		if len(res) != 1 || res[0].Name != "new" {
+			t.Errorf("%s: %v", s, res)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	x := newQueryIndexes()
+
+	for s, pos := range map[string]int{
+		`author = `:                   10,
+		`author "Wells"`:              8,
+		`title = "x"`:                 1,
+		`date = "x"`:                  8,
+		`date = 1.5`:                  8,
+		`author > "A"`:                1,
+		`author = "Wells" LIMIT -1`:   24,
+		`author = "Wells`:             10,
+		`date = 1 ORDER BY author`:    19,
+		`date = 1 ORDER isbn`:         16,
+		`date = 1 LIMIT 2 date`:       18,
+		`date = 1 AND AND date = 2`:   14,
+		`date BETWEEN 1 OR 2`:         16,
+		`date = 1 # comment`:          10,
+		`author = "Wells" AND date ?`: 27,
+	} {
+		_, err := x.m.ParseQuery(s)
+		var pe *multiindex.ParseError
+		if !errors.As(err, &pe) || pe.Pos != pos {
+			t.Errorf("%s: %v, expected at %d", s, err, pos)
+		}
+	}
+}
+
+func TestParseQueryFromStruct(t *testing.T) {
+	m, _, err := multiindex_container.FromStruct[TaggedBook]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Insert(TaggedBook{ISBN: "1", Author: "Jules Verne", Name: "Around the World", PublishedAt: time.Date(1872, 1, 1, 0, 0, 0, 0, time.UTC)})
+	m.Insert(TaggedBook{ISBN: "2", Author: "Herbert George Wells", Name: "The Time Machine", PublishedAt: time.Date(1895, 1, 1, 0, 0, 0, 0, time.UTC)})
+	m.Insert(TaggedBook{ISBN: "3", Author: "Herbert George Wells", Name: "The Invisible Man", PublishedAt: time.Date(1897, 1, 1, 0, 0, 0, 0, time.UTC)})
+
+	for s, n := range map[string]int{
+		`author = "Herbert George Wells"`:                 2,
+		`isbn = "1"`:                                      1,
+		`published >= 1890-01-01 ORDER BY published DESC`: 2,
+		`published BETWEEN 1800-01-01 AND 1880-01-01`:     1,
+	} {
+		q, err := m.ParseQuery(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if res := slices.Collect(q.All()); len(res) != n {
+			t.Errorf("%s: %v", s, res)
+		}
+	}
+
+	// composite keys cannot be written as one literal
+	if _, err := m.ParseQuery(`author_name = "Jules Verne"`); err == nil {
+		t.Errorf("query on a composite key accepted")
+	}
+}
+
+func TestParseQueryUnicode(t *testing.T) {
+	m := multiindex.New[Book]()
+	m.AddNamedIndex("автор", multiindex_container.NewOrderedNonUnique(func(b Book) string { return b.Author }))
+	m.Insert(Book{Name: "Nautilus", Author: "Жюль Верн"})
+	m.Insert(Book{Name: "Time Machine", Author: "Wells"})
+
+	q, err := m.ParseQuery(`автор = "Жюль Верн"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := slices.Collect(q.All()); len(res) != 1 || res[0].Name != "Nautilus" {
+		t.Errorf("%v", res)
+	}
+
+	// columns count runes, not bytes
+	_, err = m.ParseQuery(`автор = "Верн" ?`)
+	var pe *multiindex.ParseError
+	if !errors.As(err, &pe) || pe.Pos != 16 {
+		t.Errorf("%v, expected at 16", err)
+	}
+	if _, err = m.ParseQuery("автор = \xff"); !errors.As(err, &pe) || pe.Pos != 9 {
+		t.Errorf("%v, expected at 9", err)
+	}
+}
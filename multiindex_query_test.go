@@ -0,0 +1,156 @@
+package multiindex_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type queryIndexes struct {
+	m        *multiindex.MultiIndex[Book]
+	byISBN   *multiindex_container.MultiIndexByOrderedUnique[string, Book]
+	byAuthor *multiindex_container.MultiIndexByNonOrderedNonUnique[string, Book]
+	byDate   *multiindex_container.MultiIndexByOrderedNonUnique[int64, Book]
+}
+
+func newQueryIndexes() queryIndexes {
+	x := queryIndexes{
+		m:        multiindex.New[Book](),
+		byISBN:   multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN }),
+		byAuthor: multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Author }),
+		byDate:   multiindex_container.NewOrderedNonUnique(func(b Book) int64 { return b.PublushedAt.Unix() }),
+	}
+	x.m.AddNamedIndex("isbn", x.byISBN)
+	x.m.AddNamedIndex("author", x.byAuthor)
+	x.m.AddNamedIndex("date", x.byDate)
+	authors := []string{"Wells", "Verne", "Dumas", "Twain"}
+	for i := 0; i < 100; i++ {
+		x.m.Insert(Book{
+			Name:        fmt.Sprintf("Book %d", i),
+			Author:      authors[i%len(authors)],
+			ISBN:        fmt.Sprintf("%03d", 99-i),
+			PublushedAt: time.Unix(int64(i/2), 0),
+		})
+	}
+	return x
+}
+
+func TestQuery(t *testing.T) {
+	x := newQueryIndexes()
+
+	q := x.m.Query().
+		Where(x.byAuthor, multiindex.Eq("Wells")).
+		Where(x.byDate, multiindex.Gt(int64(20))).
+		OrderBy(x.byISBN).
+		Limit(5)
+	res := slices.Collect(q.All())
+	if q.Err() != nil {
+		t.Fatal(q.Err())
+	}
+
+	var expected []Book
+	x.byISBN.TraversalValue(func(b Book) bool {
+		if b.Author == "Wells" && b.PublushedAt.Unix() > 20 {
+			expected = append(expected, b)
+		}
+		return len(expected) < 5
+	})
+	if !slices.Equal(res, expected) {
+		t.Errorf("%v != %v", res, expected)
+	}
+
+	res = slices.Collect(x.m.Query().Where(x.byDate, multiindex.Between(int64(10), int64(11))).All())
+	if len(res) != 4 {
+		t.Errorf("Between: %v", res)
+	}
+	res = slices.Collect(x.m.Query().Where(x.byISBN, multiindex.Lt("003")).Where(x.byISBN, multiindex.Ge("001")).All())
+	if len(res) != 2 || res[0].ISBN != "001" || res[1].ISBN != "002" {
+		t.Errorf("range: %v", res)
+	}
+	res = slices.Collect(x.m.Query().OrderBy(x.byISBN).Limit(3).All())
+	if len(res) != 3 || res[0].ISBN != "000" {
+		t.Errorf("full scan: %v", res)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	x := newQueryIndexes()
+
+	q := x.m.Query().Where(x.byAuthor, multiindex.Gt("A"))
+	if slices.Collect(q.All()) != nil || !errors.Is(q.Err(), multiindex.ErrUnsupportedPredicate) {
+		t.Errorf("range on a hashed index: %v", q.Err())
+	}
+	q = x.m.Query().Where(x.byDate, multiindex.Eq(20))
+	var ie *multiindex.IndexError
+	if !errors.As(q.Err(), &ie) || ie.Index != "date" {
+		t.Errorf("wrong key type: %v", q.Err())
+	}
+	other := multiindex_container.NewOrderedUnique(func(b Book) string { return b.Name })
+	q = x.m.Query().OrderBy(other)
+	if !errors.Is(q.Err(), multiindex.ErrUnknownIndex) {
+		t.Errorf("foreign index: %v", q.Err())
+	}
+}
+
+func TestOrderedStats(t *testing.T) {
+	x := newQueryIndexes()
+	if size, distinct := x.byDate.Stats(); size != 100 || distinct != 50 {
+		t.Errorf("%d, %d", size, distinct)
+	}
+	first := slices.Collect(x.m.Query().Where(x.byDate, multiindex.Eq(int64(0))).All())
+	x.m.Erase(first[0])
+	if _, distinct := x.byDate.Stats(); distinct != 50 {
+		t.Errorf("key erased with an element left")
+	}
+	x.m.Erase(first[1])
+	if size, distinct := x.byDate.Stats(); size != 98 || distinct != 49 {
+		t.Errorf("%d, %d", size, distinct)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	x := newQueryIndexes()
+
+	plan, err := x.m.Query().
+		Where(x.byAuthor, multiindex.Eq("Wells")).
+		Where(x.byDate, multiindex.Ge(int64(45))).
+		Where(x.byISBN, multiindex.Lt("050")).
+		OrderBy(x.byISBN).
+		Explain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := multiindex.Plan{
+		Index:     "author",
+		Scan:      multiindex.PointScan,
+		Seek:      `= "Wells"`,
+		Estimated: 25,
+		Scanned:   25,
+		Intersect: []string{`isbn < "050" (estimated 33 rows)`, "date >= 45 (estimated 33 rows)"},
+		SortBy:    "isbn",
+		Returned:  2,
+	}
+	if plan.String() != expected.String() {
+		t.Errorf("\n%s\n!=\n%s", plan, expected)
+	}
+
+	plan, _ = x.m.Query().Where(x.byDate, multiindex.Between(int64(10), int64(12))).Where(x.byAuthor, multiindex.Eq("Verne")).Explain()
+	if plan.Scan != multiindex.RangeScan || plan.Index != "date" || plan.Scanned != 6 || plan.Returned != 2 {
+		t.Errorf("%s", plan)
+	}
+
+	plan, _ = x.m.Query().Where(x.byISBN, multiindex.Eq("010")).Where(x.byAuthor, multiindex.Eq("Verne")).Explain()
+	if plan.Index != "isbn" || len(plan.Filters) != 1 || plan.Filters[0] != `author = "Verne"` || plan.Returned != 1 {
+		t.Errorf("%s", plan)
+	}
+
+	plan, _ = x.m.Query().OrderBy(x.byDate).Limit(1).Explain()
+	if plan.Scan != multiindex.FullScan || plan.Index != "date" || plan.Scanned != 1 || plan.SortBy != "" {
+		t.Errorf("%s", plan)
+	}
+}
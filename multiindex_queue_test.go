@@ -0,0 +1,100 @@
+package multiindex_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type Job struct {
+	ID       int
+	Deadline int
+}
+
+func newJobs() (*multiindex.MultiIndex[Job], *multiindex_container.MultiIndexByNonOrderedUnique[int, Job], *multiindex_container.MultiIndexByOrderedNonUnique[int, Job]) {
+	m := multiindex.New[Job]()
+	byID := multiindex_container.NewNonOrderedUnique(func(j Job) int { return j.ID })
+	byDeadline := multiindex_container.NewOrderedNonUnique(func(j Job) int { return j.Deadline })
+	m.AddIndex(byID, byDeadline)
+	return m, byID, byDeadline
+}
+
+func TestPop(t *testing.T) {
+	m, byID, byDeadline := newJobs()
+	for i, deadline := range []int{30, 10, 20, 40} {
+		m.Insert(Job{ID: i, Deadline: deadline})
+	}
+
+	if j, ok := m.PeekFront(byDeadline); !ok || j.Deadline != 10 {
+		t.Errorf("PeekFront: %v", j)
+	}
+	if m.Size() != 4 {
+		t.Errorf("Peek removed element")
+	}
+
+	j, ok := m.PopFront(byDeadline)
+	if !ok || j.Deadline != 10 || byID.Find(j.ID).IsValid() {
+		t.Errorf("PopFront: %v", j)
+	}
+	j, ok = m.PopBack(byDeadline)
+	if !ok || j.Deadline != 40 || byID.Find(j.ID).IsValid() {
+		t.Errorf("PopBack: %v", j)
+	}
+	m.PopFront(byDeadline)
+	m.PopFront(byDeadline)
+	if _, ok := m.PopFront(byDeadline); ok || m.Size() != 0 {
+		t.Errorf("popped from empty")
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func TestPopWait(t *testing.T) {
+	m, _, byDeadline := newJobs()
+	s := multiindex.NewSync(m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.PopWait(ctx, byDeadline); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PopWait on empty: %v", err)
+	}
+
+	done := make(chan Job)
+	go func() {
+		j, err := s.PopWait(context.Background(), byDeadline)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		done <- j
+	}()
+	time.Sleep(5 * time.Millisecond)
+	s.Insert(Job{ID: 1, Deadline: 5})
+
+	if j := <-done; j.ID != 1 {
+		t.Errorf("PopWait: %v", j)
+	}
+	if s.Size() != 0 {
+		t.Errorf("size: %d", s.Size())
+	}
+}
+
+func TestPopRestricted(t *testing.T) {
+	l := newLibrary(t, multiindex.Restrict)
+	// Verne, the front, has books
+	if a, ok := l.authors.PopFront(l.byName); ok || a != (Author{}) || l.authors.Size() != 2 {
+		t.Errorf("PopFront: %v, %v, size %d", a, ok, l.authors.Size())
+	}
+
+	s := multiindex.NewSync(l.authors)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var ce *multiindex.ConstraintError
+	if a, err := s.PopWait(ctx, l.byName); !errors.As(err, &ce) || a != (Author{}) {
+		t.Errorf("PopWait: %v, %v", a, err)
+	}
+}
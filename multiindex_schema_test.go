@@ -0,0 +1,49 @@
+package multiindex_test
+
+import (
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+func newSchemaIndex() *multiindex.MultiIndex[Book] {
+	m := multiindex.New[Book]()
+	m.AddNamedIndex("isbn", multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN }))
+	m.AddNamedIndex("author", multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Author }))
+	m.AddNamedIndex("drafts", multiindex_container.NewSparseOrderedNonUnique(func(b Book) (string, bool) {
+		return b.Name, b.PublushedAt.IsZero()
+	}))
+	return m
+}
+
+func TestSchema(t *testing.T) {
+	m := newSchemaIndex()
+	m.Insert(Book{ISBN: "1", Author: "A", Name: "X"})
+	m.Insert(Book{ISBN: "2", Author: "A", Name: "X"})
+	m.Insert(Book{ISBN: "3", Author: "B", Name: "Y"})
+
+	s := m.Schema()
+	expected := multiindex.Schema{
+		{Name: "isbn", Kind: "ordered", Ordered: true, Unique: true, KeyType: "string", Size: 3, DistinctKeys: 3},
+		{Name: "author", Kind: "hashed", KeyType: "string", Size: 3, DistinctKeys: 2},
+		{Name: "drafts", Kind: "ordered", Ordered: true, Partial: true, KeyType: "string", Size: 3, DistinctKeys: 2},
+	}
+	if len(s) != len(expected) {
+		t.Fatalf("%v", s)
+	}
+	for i := range s {
+		if s[i] != expected[i] {
+			t.Errorf("%d: %+v != %+v", i, s[i], expected[i])
+		}
+	}
+
+	other := newSchemaIndex()
+	if other.Schema().Signature() != s.Signature() {
+		t.Errorf("signatures differ: %s, %s", other.Schema().Signature(), s.Signature())
+	}
+	other.AddIndex(multiindex_container.NewOrderedNonUnique(func(b Book) string { return b.Name }))
+	if other.Schema().Signature() == s.Signature() {
+		t.Errorf("signatures are equal")
+	}
+}
@@ -0,0 +1,143 @@
+package multiindex_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type snapshotIndexes struct {
+	m        *multiindex.MultiIndex[Book]
+	byISBN   *multiindex_container.MultiIndexByOrderedUnique[string, Book]
+	byAuthor *multiindex_container.MultiIndexByNonOrderedNonUnique[string, Book]
+	byDate   *multiindex_container.MultiIndexByExpiry[Book]
+}
+
+func newSnapshotIndexes() snapshotIndexes {
+	x := snapshotIndexes{
+		m:        multiindex.New[Book](),
+		byISBN:   multiindex_container.NewOrderedUnique(func(b Book) string { return b.ISBN }),
+		byAuthor: multiindex_container.NewNonOrderedNonUnique(func(b Book) string { return b.Author }),
+		byDate:   multiindex_container.NewExpiry(func(b Book) time.Time { return b.PublushedAt }),
+	}
+	x.m.AddNamedIndex("isbn", x.byISBN)
+	x.m.AddNamedIndex("author", x.byAuthor)
+	x.m.AddNamedIndex("drafts", multiindex_container.NewSparseOrderedNonUnique(func(b Book) (string, bool) {
+		return b.Name, b.PublushedAt.IsZero()
+	}))
+	x.m.AddNamedIndex("date", x.byDate)
+	return x
+}
+
+func TestSnapshot(t *testing.T) {
+	src := newSnapshotIndexes()
+	for i := 0; i < 1000; i++ {
+		b := Book{
+			Name:   fmt.Sprintf("Book %d", i%300),
+			Author: fmt.Sprintf("Author %d", i%7),
+			ISBN:   fmt.Sprintf("%04d", (i*7919)%1000),
+		}
+		if i%3 != 0 {
+			b.PublushedAt = time.Unix(int64(i%50), 0).UTC()
+		}
+		src.m.Insert(b)
+	}
+
+	for _, codec := range []multiindex.Codec[Book]{multiindex.GobCodec[Book]{}, multiindex.JSONCodec[Book]{}} {
+		var buf bytes.Buffer
+		if err := src.m.WriteSnapshot(&buf, codec); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := newSnapshotIndexes()
+		inserted := 0
+		cancel := dst.m.Observe(func(c multiindex.Change[Book]) {
+			if c.Op == multiindex.OpInsert {
+				inserted++
+			}
+		})
+		if err := dst.m.LoadSnapshot(bytes.NewReader(buf.Bytes()), codec); err != nil {
+			t.Fatalf("%T: %v", codec, err)
+		}
+		cancel()
+		if inserted != src.m.Size() {
+			t.Errorf("%T: observers notified of %d insertions, want %d", codec, inserted, src.m.Size())
+		}
+		if err := dst.m.Verify(); err != nil {
+			t.Errorf("%T: %v", codec, err)
+		}
+		if ok, err := dst.byISBN.Container.IsRbTree(); !ok {
+			t.Errorf("%T: %v", codec, err)
+		}
+		if ok, err := dst.byDate.Container.IsRbTree(); !ok {
+			t.Errorf("%T: %v", codec, err)
+		}
+		if dst.m.Schema().String() != src.m.Schema().String() {
+			t.Errorf("%T:\n%s\n!=\n%s", codec, dst.m.Schema(), src.m.Schema())
+		}
+		src.byISBN.TraversalValue(func(b Book) bool {
+			if !dst.m.Contains(b) {
+				t.Errorf("%T: lost %v", codec, b)
+				return false
+			}
+			return true
+		})
+
+		// still usable after a bulk load
+		if !dst.m.Insert(Book{ISBN: "x"}) || dst.m.Insert(Book{ISBN: "0001"}) {
+			t.Errorf("%T: insert after load", codec)
+		}
+		if err := dst.m.Verify(); err != nil {
+			t.Errorf("%T: %v", codec, err)
+		}
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	src := multiindex.New[Book]()
+	src.AddIndex(multiindex_container.NewOrderedNonUnique(func(b Book) string { return b.Name }))
+	src.Insert(Book{Name: "a", ISBN: "1"})
+	src.Insert(Book{Name: "b", ISBN: "1"})
+	var buf bytes.Buffer
+	if err := src.WriteSnapshot(&buf, multiindex.GobCodec[Book]{}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	dst := newSnapshotIndexes()
+	err := dst.m.LoadSnapshot(bytes.NewReader(data), multiindex.GobCodec[Book]{})
+	var ie *multiindex.IndexError
+	if !errors.As(err, &ie) || ie.Index != "isbn" {
+		t.Errorf("duplicate: %v", err)
+	}
+	if dst.m.Size() != 0 || dst.byAuthor.Size() != 0 || dst.byDate.Size() != 0 {
+		t.Errorf("partially loaded")
+	}
+
+	corrupt := bytes.Clone(data)
+	corrupt[len(corrupt)/2] ^= 1
+	for _, snapshot := range [][]byte{corrupt, data[:len(data)-1], data[:3]} {
+		err = newSnapshotIndexes().m.LoadSnapshot(bytes.NewReader(snapshot), multiindex.GobCodec[Book]{})
+		if !errors.Is(err, multiindex.ErrCorruptSnapshot) {
+			t.Errorf("%v", err)
+		}
+	}
+
+	if multiindex.New[Book]().WriteSnapshot(&buf, multiindex.GobCodec[Book]{}) == nil {
+		t.Errorf("wrote a multiindex without indexes")
+	}
+	if multiindex.New[Book]().LoadSnapshot(bytes.NewReader(data), multiindex.GobCodec[Book]{}) == nil {
+		t.Errorf("loaded into a multiindex without indexes")
+	}
+
+	dst = newSnapshotIndexes()
+	dst.m.Insert(Book{})
+	if dst.m.LoadSnapshot(bytes.NewReader(data), multiindex.GobCodec[Book]{}) == nil {
+		t.Errorf("loaded into a non-empty multiindex")
+	}
+}
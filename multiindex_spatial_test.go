@@ -0,0 +1,231 @@
+package multiindex_test
+
+import (
+	"errors"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+type Feature struct {
+	ID     int
+	X0, Y0 float64
+	X1, Y1 float64
+}
+
+func (f Feature) Rect() multiindex_container.Rect {
+	return multiindex_container.Rect2D(f.X0, f.Y0, f.X1, f.Y1)
+}
+
+func collectIDs[V any](seq func(func(V) bool), id func(V) int) map[int]bool {
+	ids := make(map[int]bool)
+	for v := range seq {
+		ids[id(v)] = true
+	}
+	return ids
+}
+
+func TestRTree(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	m := multiindex.New[Feature]()
+	byID := multiindex_container.NewNonOrderedUnique(func(f Feature) int { return f.ID })
+	byRect := multiindex_container.NewRTree(Feature.Rect)
+	m.AddIndex(byRect, byID)
+
+	features := make(map[int]Feature)
+	for i := 0; i < 500; i++ {
+		x, y := rnd.Float64()*100, rnd.Float64()*100
+		f := Feature{ID: i, X0: x, Y0: y, X1: x + rnd.Float64()*10, Y1: y + rnd.Float64()*10}
+		if !m.Insert(f) {
+			t.Fatalf("not inserted: %v", f)
+		}
+		features[i] = f
+	}
+	for i := 0; i < 500; i += 3 {
+		m.Erase(features[i])
+		delete(features, i)
+	}
+	if err := m.Verify(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	id := func(f Feature) int { return f.ID }
+	for q := 0; q < 50; q++ {
+		x, y := rnd.Float64()*100, rnd.Float64()*100
+		r := multiindex_container.Rect2D(x, y, x+rnd.Float64()*30, y+rnd.Float64()*30)
+
+		intersects := collectIDs(byRect.Intersects(r), id)
+		contains := collectIDs(byRect.Contains(r), id)
+		within := collectIDs(byRect.Within(r), id)
+		for _, f := range features {
+			if f.Rect().Intersects(r) != intersects[f.ID] {
+				t.Errorf("Intersects(%v): mismatch on %v", r, f)
+			}
+			if f.Rect().Contains(r) != contains[f.ID] {
+				t.Errorf("Contains(%v): mismatch on %v", r, f)
+			}
+			if r.Contains(f.Rect()) != within[f.ID] {
+				t.Errorf("Within(%v): mismatch on %v", r, f)
+			}
+		}
+	}
+
+	// rollback: a duplicate ID must not leave a dangling entry in the R-tree
+	for _, f := range features {
+		dup := f
+		dup.X0 -= 1000
+		if m.Insert(dup) {
+			t.Errorf("duplicate inserted")
+		}
+		break
+	}
+	if byRect.Size() != len(features) {
+		t.Errorf("size: %d != %d", byRect.Size(), len(features))
+	}
+}
+
+type Shape struct {
+	ID  int
+	Box multiindex_container.Rect
+}
+
+func TestRTreeDimensions(t *testing.T) {
+	m := multiindex.New[*Shape]()
+	byBox := multiindex_container.NewRTree(func(s *Shape) multiindex_container.Rect { return s.Box })
+	m.AddIndex(byBox)
+
+	flat := &Shape{ID: 1, Box: multiindex_container.Rect2D(0, 0, 10, 10)}
+	if !m.Insert(flat) {
+		t.Fatalf("2D box not inserted")
+	}
+	for _, s := range []*Shape{
+		{ID: 2, Box: multiindex_container.Rect3D(0, 0, 0, 10, 10, 10)},
+		{ID: 3, Box: multiindex_container.Rect{Min: []float64{0, 0}, Max: []float64{1, 1, 1}}},
+	} {
+		if err := m.TryInsert(s); !errors.Is(err, multiindex.ErrRejected) {
+			t.Errorf("shape %d: %v", s.ID, err)
+		}
+	}
+	if byBox.Size() != 1 {
+		t.Errorf("size %d != 1", byBox.Size())
+	}
+
+	id := func(s *Shape) int { return s.ID }
+	cube := multiindex_container.Rect3D(1, 1, 1, 2, 2, 2)
+	for name, seq := range map[string]func(func(*Shape) bool){
+		"intersects": byBox.Intersects(cube),
+		"contains":   byBox.Contains(cube),
+		"within":     byBox.Within(multiindex_container.Rect3D(-1, -1, -1, 20, 20, 20)),
+	} {
+		if ids := collectIDs(seq, id); len(ids) != 0 {
+			t.Errorf("%s a 3D box: %v", name, ids)
+		}
+	}
+	if flat.Box.Intersects(cube) || flat.Box.Contains(cube) || cube.Contains(flat.Box) {
+		t.Errorf("boxes of different dimensions overlap")
+	}
+
+	// the dimension is free again once the tree is empty
+	m.Erase(flat)
+	if !m.Insert(&Shape{ID: 2, Box: cube}) {
+		t.Errorf("3D box not inserted into the empty tree")
+	}
+}
+
+type Warehouse struct {
+	ID  int
+	Pos [2]float64
+}
+
+func TestKDTree(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+
+	for _, metric := range []multiindex_container.Metric{
+		multiindex_container.Euclidean{},
+		multiindex_container.Manhattan{},
+		multiindex_container.Chebyshev{},
+	} {
+		m := multiindex.New[Warehouse]()
+		byID := multiindex_container.NewNonOrderedUnique(func(w Warehouse) int { return w.ID })
+		byPos := multiindex_container.NewKDTree(2, func(w Warehouse) []float64 { return w.Pos[:] }, metric)
+		m.AddIndex(byID, byPos)
+
+		warehouses := make(map[int]Warehouse)
+		for i := 0; i < 400; i++ {
+			w := Warehouse{ID: i, Pos: [2]float64{float64(rnd.Intn(50)), float64(rnd.Intn(50))}}
+			m.Insert(w)
+			warehouses[i] = w
+		}
+		for i := 0; i < 400; i += 2 {
+			m.Erase(warehouses[i])
+			delete(warehouses, i)
+		}
+		if err := m.Verify(); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		for q := 0; q < 30; q++ {
+			p := []float64{rnd.Float64() * 50, rnd.Float64() * 50}
+
+			nearest := byPos.Nearest(p, 10)
+			if len(nearest) != 10 {
+				t.Fatalf("Nearest: %d results", len(nearest))
+			}
+			kth := metric.Distance(p, nearest[9].Pos[:])
+			closer := 0
+			for _, w := range warehouses {
+				if metric.Distance(p, w.Pos[:]) < kth {
+					closer++
+				}
+			}
+			if closer > 9 {
+				t.Errorf("Nearest(%v): %d elements closer than the 10th", p, closer)
+			}
+			for i := 1; i < len(nearest); i++ {
+				if metric.Distance(p, nearest[i-1].Pos[:]) > metric.Distance(p, nearest[i].Pos[:]) {
+					t.Errorf("Nearest(%v): not sorted", p)
+				}
+			}
+
+			within := collectIDs(byPos.WithinRadius(p, 7), func(w Warehouse) int { return w.ID })
+			for _, w := range warehouses {
+				if (metric.Distance(p, w.Pos[:]) <= 7) != within[w.ID] {
+					t.Errorf("WithinRadius(%v): mismatch on %v", p, w)
+				}
+			}
+		}
+	}
+}
+
+func TestKDTreeRebalance(t *testing.T) {
+	const n = 10000
+	for name, pos := range map[string]func(i int) [2]float64{
+		"identical": func(i int) [2]float64 { return [2]float64{1, 1} },
+		"sorted":    func(i int) [2]float64 { return [2]float64{float64(i), float64(i)} },
+	} {
+		m := multiindex.New[Warehouse]()
+		byPos := multiindex_container.NewKDTree(2, func(w Warehouse) []float64 { return w.Pos[:] }, nil)
+		m.AddIndex(multiindex_container.NewNonOrderedUnique(func(w Warehouse) int { return w.ID }), byPos)
+		for i := 0; i < n; i++ {
+			m.Insert(Warehouse{ID: i, Pos: pos(i)})
+		}
+		for i := 0; i < n; i += 2 {
+			m.Erase(Warehouse{ID: i, Pos: pos(i)})
+		}
+		// amortized O(log n) moves per operation, far below the O(n) of a full rebuild each time
+		if limit := 4 * n * bits.Len(n); byPos.Rebuilt() > limit {
+			t.Errorf("%s: %d nodes rebuilt, more than %d", name, byPos.Rebuilt(), limit)
+		}
+		if err := m.Verify(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		p := pos(1)
+		if got := len(byPos.Nearest(p[:], 5)); got != 5 {
+			t.Errorf("%s: Nearest: %d results", name, got)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package multiindex_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/agmt/go-multiindex"
+	"github.com/agmt/go-multiindex/multiindex_container"
+)
+
+func TestVersions(t *testing.T) {
+	m, _ := newDurableIndex()
+	a := Book{Name: "a", ISBN: "001"}
+	m.Insert(a)
+	m.EnableVersions()
+	va := m.Version(a)
+	if va == 0 {
+		t.Fatal("no version for an element present before EnableVersions")
+	}
+
+	a2 := Book{Name: "a", Author: "Verne", ISBN: "001"}
+	if err := m.ModifyVersion(a, va, a2); err != nil {
+		t.Fatal(err)
+	}
+	if m.Version(a) != 0 || m.Version(a2) <= va {
+		t.Fatalf("versions %d, %d after ModifyVersion", m.Version(a), m.Version(a2))
+	}
+
+	// modified back: same value, new version
+	m.Modify(a2, a)
+	if err := m.ModifyVersion(a, va, a2); !errors.Is(err, multiindex.ErrConflict) {
+		t.Fatalf("ModifyVersion with a stale version: %v", err)
+	}
+
+	if ok, err := m.CompareAndSwap(a2, a); ok || err != nil {
+		t.Fatalf("CompareAndSwap of an absent element: %v, %v", ok, err)
+	}
+	m.Insert(Book{Name: "b", ISBN: "002"})
+	var ierr *multiindex.IndexError
+	if ok, err := m.CompareAndSwap(a, Book{Name: "c", ISBN: "002"}); ok || !errors.As(err, &ierr) || ierr.Index != "isbn" {
+		t.Fatalf("CompareAndSwap to a duplicate: %v, %v", ok, err)
+	}
+	if ok, err := m.CompareAndSwap(a, a2); !ok || err != nil {
+		t.Fatalf("CompareAndSwap: %v, %v", ok, err)
+	}
+
+	m.Erase(a2)
+	if m.Version(a2) != 0 {
+		t.Fatal("version of an erased element")
+	}
+}
+
+type counter struct {
+	ID string
+	N  int
+}
+
+func TestVersionsConcurrent(t *testing.T) {
+	m := multiindex.New[counter]()
+	byID := multiindex_container.NewNonOrderedUnique(func(c counter) string { return c.ID })
+	m.AddIndex(byID)
+	m.Insert(counter{ID: "x"})
+	m.EnableVersions()
+	s := multiindex.NewSync(m)
+
+	const workers, increments = 8, 100
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				for {
+					c, version, ok := s.Lookup(func(m *multiindex.MultiIndex[counter]) multiindex.ConstIterator[counter] {
+						return byID.Find("x")
+					})
+					if !ok {
+						panic("counter not found")
+					}
+					updated := counter{ID: c.ID, N: c.N + 1}
+					err := s.ModifyVersion(c, version, updated)
+					if err == nil {
+						break
+					}
+					if !errors.Is(err, multiindex.ErrConflict) {
+						panic(err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	c, _, _ := s.Lookup(func(m *multiindex.MultiIndex[counter]) multiindex.ConstIterator[counter] { return byID.Find("x") })
+	if c.N != workers*increments {
+		t.Fatalf("counter %d, want %d", c.N, workers*increments)
+	}
+}
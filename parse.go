@@ -0,0 +1,377 @@
+package multiindex
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseError reports a malformed query; Pos is the 1-based column of the offending token
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("multiindex: query: column %d: %s", e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokTime
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // identifiers, operators and unquoted string literals
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func (t token) keyword(kw string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+var (
+	timeLiteral   = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:\d{2})?)?`)
+	numberLiteral = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][+-]?\d+)?`)
+	timeLayouts   = []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02"}
+)
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	// col returns the 1-based column, in runes, of byte offset `i`
+	col := func(i int) int {
+		return utf8.RuneCountInString(s[:i]) + 1
+	}
+	for i := 0; i < len(s); {
+		c, size := utf8.DecodeRuneInString(s[i:])
+		pos := col(i)
+		switch {
+		case c == utf8.RuneError && size == 1:
+			return nil, &ParseError{pos, "invalid UTF-8"}
+		case unicode.IsSpace(c):
+			i += size
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, &ParseError{pos, "unterminated string"}
+			}
+			str, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, &ParseError{pos, "malformed string " + s[i:end+1]}
+			}
+			tokens = append(tokens, token{tokString, str, pos})
+			i = end + 1
+		case strings.ContainsRune("=<>!", c):
+			op := s[i : i+1]
+			if i+1 < len(s) && s[i+1] == '=' {
+				op = s[i : i+2]
+			}
+			if op == "!" {
+				return nil, &ParseError{pos, "unexpected '!'"}
+			}
+			tokens = append(tokens, token{tokOp, op, pos})
+			i += len(op)
+		case c == '-' || unicode.IsDigit(c):
+			if m := timeLiteral.FindString(s[i:]); m != "" {
+				tokens = append(tokens, token{tokTime, m, pos})
+				i += len(m)
+			} else if m := numberLiteral.FindString(s[i:]); m != "" {
+				tokens = append(tokens, token{tokNumber, m, pos})
+				i += len(m)
+			} else {
+				return nil, &ParseError{pos, fmt.Sprintf("unexpected %q", c)}
+			}
+		case c == '_' || unicode.IsLetter(c):
+			end := i
+			for end < len(s) {
+				r, n := utf8.DecodeRuneInString(s[end:])
+				if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				end += n
+			}
+			tokens = append(tokens, token{tokIdent, s[i:end], pos})
+			i = end
+		default:
+			return nil, &ParseError{pos, fmt.Sprintf("unexpected %q", c)}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: col(len(s))}), nil
+}
+
+type parser[V comparable] struct {
+	m      *MultiIndex[V]
+	tokens []token
+	cur    int
+}
+
+// ParseQuery builds a Query from text, where fields are index names (see AddNamedIndex):
+//
+//	author = "Jules Verne" AND published >= 2020-01-01 ORDER BY isbn DESC LIMIT 5
+//
+// Conditions use =, <, <=, >, >= or BETWEEN lo AND hi; literals are quoted strings,
+// numbers and times (2006-01-02, 2006-01-02T15:04:05Z07:00), converted to the key type
+// of the index (the field type for indexes built by FromStruct, whose composite keys cannot be queried).
+// Keywords are case-insensitive.
+func (m *MultiIndex[V]) ParseQuery(s string) (*Query[V], error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser[V]{m: m, tokens: tokens}
+	return p.query()
+}
+
+func (p *parser[V]) peek() token {
+	return p.tokens[p.cur]
+}
+
+func (p *parser[V]) next() token {
+	t := p.tokens[p.cur]
+	if t.kind != tokEOF {
+		p.cur++
+	}
+	return t
+}
+
+func (p *parser[V]) errorf(t token, format string, args ...any) error {
+	return &ParseError{t.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser[V]) expect(kw string) error {
+	if t := p.next(); !t.keyword(kw) {
+		return p.errorf(t, "expected %s, found %s", kw, t)
+	}
+	return nil
+}
+
+func (p *parser[V]) query() (*Query[V], error) {
+	q := p.m.Query()
+	if t := p.peek(); t.kind != tokEOF && !t.keyword("ORDER") && !t.keyword("LIMIT") {
+		for {
+			if err := p.condition(q); err != nil {
+				return nil, err
+			}
+			if !p.peek().keyword("AND") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if p.peek().keyword("ORDER") {
+		p.next()
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		t := p.next()
+		idx, err := p.index(t)
+		if err != nil {
+			return nil, err
+		}
+		sorted, ok := idx.(SortedQueryable[V])
+		if !ok {
+			return nil, p.errorf(t, "index %s is not ordered", t.text)
+		}
+		switch {
+		case p.peek().keyword("DESC"):
+			p.next()
+			q.OrderByDesc(sorted)
+		case p.peek().keyword("ASC"):
+			p.next()
+			fallthrough
+		default:
+			q.OrderBy(sorted)
+		}
+	}
+
+	if p.peek().keyword("LIMIT") {
+		p.next()
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != tokNumber || err != nil || n < 0 {
+			return nil, p.errorf(t, "expected a row count, found %s", t)
+		}
+		q.Limit(n)
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return q, q.Err()
+}
+
+func (p *parser[V]) index(t token) (Queryable[V], error) {
+	if t.kind != tokIdent {
+		return nil, p.errorf(t, "expected an index name, found %s", t)
+	}
+	idx := p.m.Index(t.text)
+	if idx == nil {
+		return nil, p.errorf(t, "unknown index %s", t.text)
+	}
+	q, ok := idx.(Queryable[V])
+	if !ok {
+		return nil, p.errorf(t, "index %s cannot be queried", t.text)
+	}
+	return q, nil
+}
+
+func (p *parser[V]) condition(q *Query[V]) error {
+	name := p.next()
+	idx, err := p.index(name)
+	if err != nil {
+		return err
+	}
+
+	var pred Predicate
+	op := p.next()
+	switch {
+	case op.keyword("BETWEEN"):
+		lo, err := p.literal(idx)
+		if err != nil {
+			return err
+		}
+		if err := p.expect("AND"); err != nil {
+			return err
+		}
+		hi, err := p.literal(idx)
+		if err != nil {
+			return err
+		}
+		pred = Between(lo, hi)
+	case op.kind == tokOp:
+		k, err := p.literal(idx)
+		if err != nil {
+			return err
+		}
+		switch op.text {
+		case "=", "==":
+			pred = Eq(k)
+		case "<":
+			pred = Lt(k)
+		case "<=":
+			pred = Le(k)
+		case ">":
+			pred = Gt(k)
+		case ">=":
+			pred = Ge(k)
+		default:
+			return p.errorf(op, "unsupported operator %s", op.text)
+		}
+	default:
+		return p.errorf(op, "expected an operator, found %s", op)
+	}
+
+	if q.Where(idx, pred); q.Err() != nil {
+		return p.errorf(name, "%v", q.Err())
+	}
+	return nil
+}
+
+// literal parses the next token as a key of `idx`
+func (p *parser[V]) literal(idx Queryable[V]) (any, error) {
+	t := p.next()
+	var typ reflect.Type
+	if kt, ok := idx.(KeyTyper); ok {
+		typ = kt.KeyType()
+	}
+	k, err := convertLiteral(t, typ)
+	if err != nil {
+		return nil, p.errorf(t, "%v", err)
+	}
+	return k, nil
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// convertLiteral converts `t` to `typ`, or to its natural type if `typ` is nil
+func convertLiteral(t token, typ reflect.Type) (any, error) {
+	if t.kind != tokString && t.kind != tokNumber && t.kind != tokTime {
+		return nil, fmt.Errorf("expected a literal, found %s", t)
+	}
+	if typ == nil {
+		switch t.kind {
+		case tokNumber:
+			if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+				return n, nil
+			}
+			return strconv.ParseFloat(t.text, 64)
+		case tokTime:
+			return parseTime(t.text)
+		}
+		return t.text, nil
+	}
+
+	if typ == timeType {
+		if t.kind == tokNumber {
+			return nil, fmt.Errorf("expected a time, found %s", t)
+		}
+		return parseTime(t.text)
+	}
+	mismatch := fmt.Errorf("cannot use %s as %v", t, typ)
+	var v reflect.Value
+	switch typ.Kind() {
+	case reflect.String:
+		if t.kind != tokString {
+			return nil, mismatch
+		}
+		v = reflect.ValueOf(t.text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(t.text, 10, typ.Bits())
+		if t.kind != tokNumber || err != nil {
+			return nil, mismatch
+		}
+		v = reflect.ValueOf(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(t.text, 10, typ.Bits())
+		if t.kind != tokNumber || err != nil {
+			return nil, mismatch
+		}
+		v = reflect.ValueOf(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(t.text, typ.Bits())
+		if t.kind != tokNumber || err != nil {
+			return nil, mismatch
+		}
+		v = reflect.ValueOf(f)
+	default:
+		return nil, fmt.Errorf("keys of type %v cannot be written in queries", typ)
+	}
+	return v.Convert(typ).Interface(), nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("malformed time %s", s)
+}
@@ -0,0 +1,461 @@
+package multiindex
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedPredicate is reported when an index cannot evaluate a predicate (e.g. a range on a hashed index)
+	ErrUnsupportedPredicate = errors.New("unsupported predicate")
+	// ErrUnknownIndex is reported when a query refers to an index of another MultiIndex
+	ErrUnknownIndex = errors.New("index does not belong to the multiindex")
+)
+
+// Bound is one end of a Predicate; a nil Key means unbounded
+type Bound struct {
+	Key       any
+	Inclusive bool
+}
+
+// Predicate restricts the keys of an index to a range
+type Predicate struct {
+	Lo, Hi Bound
+	point  bool
+}
+
+func Eq(k any) Predicate {
+	return Predicate{Lo: Bound{k, true}, Hi: Bound{k, true}, point: true}
+}
+
+func Gt(k any) Predicate {
+	return Predicate{Lo: Bound{k, false}}
+}
+
+func Ge(k any) Predicate {
+	return Predicate{Lo: Bound{k, true}}
+}
+
+func Lt(k any) Predicate {
+	return Predicate{Hi: Bound{k, false}}
+}
+
+func Le(k any) Predicate {
+	return Predicate{Hi: Bound{k, true}}
+}
+
+// Between matches lo <= key <= hi
+func Between(lo, hi any) Predicate {
+	return Predicate{Lo: Bound{lo, true}, Hi: Bound{hi, true}}
+}
+
+// IsPoint tells whether p was made by Eq
+func (p Predicate) IsPoint() bool {
+	return p.point
+}
+
+func (p Predicate) String() string {
+	switch {
+	case p.IsPoint():
+		return "= " + formatKey(p.Lo.Key)
+	case p.Lo.Key == nil && p.Hi.Key == nil:
+		return "any"
+	}
+	var parts []string
+	if p.Lo.Key != nil {
+		op := ">"
+		if p.Lo.Inclusive {
+			op = ">="
+		}
+		parts = append(parts, op+" "+formatKey(p.Lo.Key))
+	}
+	if p.Hi.Key != nil {
+		op := "<"
+		if p.Hi.Inclusive {
+			op = "<="
+		}
+		parts = append(parts, op+" "+formatKey(p.Hi.Key))
+	}
+	return strings.Join(parts, " and ")
+}
+
+func formatKey(k any) string {
+	if s, ok := k.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(k)
+}
+
+// Queryable is implemented by indexes usable in Query (ordered, hashed and bitmap containers)
+type Queryable[V comparable] interface {
+	MultiIndexByI[V]
+	// Stats returns the number of elements and of distinct keys
+	Stats() (size, distinct int)
+	// Seek yields the elements matching `p`, in key order for ordered indexes
+	Seek(p Predicate) (iter.Seq[V], error)
+	// Matcher returns a test of elements against `p`
+	Matcher(p Predicate) (func(v V) bool, error)
+}
+
+// KeyTyper is implemented by indexes telling the type of their keys, see ParseQuery
+type KeyTyper interface {
+	KeyType() reflect.Type
+}
+
+// SortedQueryable is implemented by ordered indexes, which can be used in Query.OrderBy
+type SortedQueryable[V comparable] interface {
+	Queryable[V]
+	CompareValues(a, b V) int
+}
+
+// Query selects the elements matching all its predicates:
+//
+//	for b := range m.Query().Where(byAuthor, Eq("Wells")).Where(byDate, Gt(t)).OrderBy(byISBN).Limit(10).All() {
+//		...
+//	}
+//
+// The most selective predicate, estimated from Stats, drives the scan. Other predicates
+// about as selective are intersected as sets, the rest are checked on each candidate.
+type Query[V comparable] struct {
+	m       *MultiIndex[V]
+	clauses []*clause[V]
+	order   SortedQueryable[V]
+	desc    bool
+	limit   int
+	err     error
+}
+
+type clause[V comparable] struct {
+	idx   Queryable[V]
+	pred  Predicate
+	match func(v V) bool
+	est   int
+}
+
+// a predicate selecting at most intersectRatio times the rows of the driving one is intersected
+const intersectRatio = 2
+
+type queryPlan[V comparable] struct {
+	driver    *clause[V] // nil for a full scan
+	intersect []*clause[V]
+	filters   []*clause[V]
+	sorted    bool // the scan yields elements in the requested order
+}
+
+func (m *MultiIndex[V]) Query() *Query[V] {
+	return &Query[V]{m: m, limit: -1}
+}
+
+// Where adds a predicate on the keys of `idx`
+func (q *Query[V]) Where(idx Queryable[V], p Predicate) *Query[V] {
+	if q.err != nil {
+		return q
+	}
+	name, err := q.indexName(idx)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	match, err := idx.Matcher(p)
+	if err != nil {
+		q.err = &IndexError{Index: name, Err: err}
+		return q
+	}
+	q.clauses = append(q.clauses, &clause[V]{idx: idx, pred: p, match: match})
+	return q
+}
+
+// OrderBy sorts the result by the keys of `idx`
+func (q *Query[V]) OrderBy(idx SortedQueryable[V]) *Query[V] {
+	if q.err != nil {
+		return q
+	}
+	if _, err := q.indexName(idx); err != nil {
+		q.err = err
+		return q
+	}
+	q.order = idx
+	q.desc = false
+	return q
+}
+
+// OrderByDesc sorts the result by the keys of `idx`, greatest first
+func (q *Query[V]) OrderByDesc(idx SortedQueryable[V]) *Query[V] {
+	q.OrderBy(idx)
+	q.desc = true
+	return q
+}
+
+// Limit stops the query after `n` elements
+func (q *Query[V]) Limit(n int) *Query[V] {
+	q.limit = n
+	return q
+}
+
+// Err returns the error which made the query yield nothing
+func (q *Query[V]) Err() error {
+	return q.err
+}
+
+func (q *Query[V]) indexName(idx MultiIndexByI[V]) (string, error) {
+	for i, cont := range q.m.MultiIndexBy {
+		if cont == idx {
+			return q.m.IndexName(i), nil
+		}
+	}
+	return "", ErrUnknownIndex
+}
+
+func estimate(size, distinct int, p Predicate) int {
+	switch {
+	case p.IsPoint():
+		if distinct == 0 {
+			return 0
+		}
+		return (size + distinct - 1) / distinct
+	case p.Lo.Key != nil && p.Hi.Key != nil:
+		return size / 4
+	case p.Lo.Key != nil || p.Hi.Key != nil:
+		return size / 3
+	}
+	return size
+}
+
+func (q *Query[V]) plan() queryPlan[V] {
+	var p queryPlan[V]
+	for _, c := range q.clauses {
+		size, distinct := c.idx.Stats()
+		c.est = estimate(size, distinct, c.pred)
+	}
+	clauses := slices.Clone(q.clauses)
+	// on a tie, prefer the index which already gives the requested order
+	slices.SortStableFunc(clauses, func(a, b *clause[V]) int {
+		if a.est != b.est {
+			return a.est - b.est
+		}
+		if q.order != nil && !q.desc && a.idx == Queryable[V](q.order) && b.idx != Queryable[V](q.order) {
+			return -1
+		}
+		return 0
+	})
+	if len(clauses) > 0 {
+		p.driver = clauses[0]
+		p.sorted = q.order != nil && !q.desc && p.driver.idx == Queryable[V](q.order)
+		for _, c := range clauses[1:] {
+			if c.est <= intersectRatio*p.driver.est {
+				p.intersect = append(p.intersect, c)
+			} else {
+				p.filters = append(p.filters, c)
+			}
+		}
+	} else {
+		p.sorted = q.order != nil && !q.desc
+	}
+	return p
+}
+
+// All yields the matching elements; check Err afterwards
+func (q *Query[V]) All() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		if q.err != nil || q.limit == 0 {
+			return
+		}
+		q.run(q.plan(), yield, nil)
+	}
+}
+
+func (q *Query[V]) seek(c *clause[V]) (iter.Seq[V], error) {
+	seq, err := c.idx.Seek(c.pred)
+	if err != nil {
+		name, _ := q.indexName(c.idx)
+		return nil, &IndexError{Index: name, Err: err}
+	}
+	return seq, nil
+}
+
+func (q *Query[V]) scan(p queryPlan[V]) (iter.Seq[V], error) {
+	switch {
+	case p.driver != nil:
+		return q.seek(p.driver)
+	case q.order != nil:
+		return q.order.Seek(Predicate{})
+	}
+	primary := q.m.MultiIndexBy[q.m.primary()]
+	return func(yield func(V) bool) {
+		primary.TraversalValue(yield)
+	}, nil
+}
+
+// run executes `p`, counting into `stats` if it is not nil
+func (q *Query[V]) run(p queryPlan[V], yield func(V) bool, stats *Plan) {
+	seq, err := q.scan(p)
+	if err != nil {
+		q.err = err
+		return
+	}
+	if stats != nil {
+		scan := seq
+		seq = func(yield func(V) bool) {
+			for v := range scan {
+				stats.Scanned++
+				if !yield(v) {
+					return
+				}
+			}
+		}
+	}
+
+	var keep map[V]bool
+	for _, c := range p.intersect {
+		s, err := q.seek(c)
+		if err != nil {
+			q.err = err
+			return
+		}
+		next := make(map[V]bool)
+		for v := range s {
+			if keep == nil || keep[v] {
+				next[v] = true
+			}
+		}
+		keep = next
+	}
+
+	matches := func(yield func(V) bool) {
+	scan:
+		for v := range seq {
+			if keep != nil && !keep[v] {
+				continue
+			}
+			for _, c := range p.filters {
+				if !c.match(v) {
+					continue scan
+				}
+			}
+			if !yield(v) {
+				return
+			}
+		}
+	}
+	if q.order != nil && !p.sorted {
+		res := slices.Collect(iter.Seq[V](matches))
+		cmp := q.order.CompareValues
+		if q.desc {
+			cmp = func(a, b V) int { return q.order.CompareValues(b, a) }
+		}
+		slices.SortStableFunc(res, cmp)
+		matches = slices.Values(res)
+	}
+
+	n := 0
+	for v := range matches {
+		n++
+		if stats != nil {
+			stats.Returned = n
+		} else {
+			q.m.Touch(v)
+		}
+		if !yield(v) || n == q.limit {
+			return
+		}
+	}
+}
+
+type ScanKind int
+
+const (
+	FullScan ScanKind = iota
+	PointScan
+	RangeScan
+)
+
+func (k ScanKind) String() string {
+	switch k {
+	case PointScan:
+		return "point scan"
+	case RangeScan:
+		return "range scan"
+	}
+	return "full scan"
+}
+
+// Plan describes how a query was executed, see Query.Explain
+type Plan struct {
+	Index     string // the scanned index
+	Scan      ScanKind
+	Seek      string // the predicate the index was scanned with
+	Estimated int    // rows expected from the scan
+	Scanned   int    // rows actually read from the scan
+	Intersect []string
+	Filters   []string // predicates checked on each scanned row
+	SortBy    string   // index whose order was applied after the scan, if any
+	Returned  int
+}
+
+func (p Plan) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s on %s", p.Scan, p.Index)
+	if p.Seek != "" {
+		fmt.Fprintf(&sb, " %s", p.Seek)
+	}
+	fmt.Fprintf(&sb, " (estimated %d rows, scanned %d)\n", p.Estimated, p.Scanned)
+	for _, s := range p.Intersect {
+		fmt.Fprintf(&sb, "intersect %s\n", s)
+	}
+	for _, s := range p.Filters {
+		fmt.Fprintf(&sb, "filter %s\n", s)
+	}
+	if p.SortBy != "" {
+		fmt.Fprintf(&sb, "sort by %s\n", p.SortBy)
+	}
+	fmt.Fprintf(&sb, "returned %d rows", p.Returned)
+	return sb.String()
+}
+
+// Explain runs the query, discarding its result, and reports the plan with the actual row counts
+func (q *Query[V]) Explain() (Plan, error) {
+	if q.err != nil {
+		return Plan{}, q.err
+	}
+	p := q.plan()
+	var res Plan
+	switch {
+	case p.driver != nil:
+		res.Index, _ = q.indexName(p.driver.idx)
+		res.Scan = RangeScan
+		if p.driver.pred.IsPoint() {
+			res.Scan = PointScan
+		}
+		res.Seek = p.driver.pred.String()
+		res.Estimated = p.driver.est
+	case q.order != nil:
+		res.Index, _ = q.indexName(q.order)
+		res.Estimated = q.order.Size()
+	default:
+		res.Index = q.m.IndexName(q.m.primary())
+		res.Estimated = q.m.Size()
+	}
+	for _, c := range p.intersect {
+		name, _ := q.indexName(c.idx)
+		res.Intersect = append(res.Intersect, fmt.Sprintf("%s %s (estimated %d rows)", name, c.pred, c.est))
+	}
+	for _, c := range p.filters {
+		name, _ := q.indexName(c.idx)
+		res.Filters = append(res.Filters, fmt.Sprintf("%s %s", name, c.pred))
+	}
+	if q.order != nil && !p.sorted {
+		res.SortBy, _ = q.indexName(q.order)
+		if q.desc {
+			res.SortBy += " desc"
+		}
+	}
+
+	if q.limit != 0 {
+		q.run(p, func(V) bool { return true }, &res)
+	}
+	return res, q.err
+}
@@ -0,0 +1,60 @@
+package multiindex
+
+// OrderedIndex is implemented by ordered containers (multiindex_container.NewOrderedUnique, ...)
+type OrderedIndex[V comparable] interface {
+	MultiIndexByI[V]
+	Front() ConstIterator[V]
+	Back() ConstIterator[V]
+}
+
+// PeekFront returns the element with the smallest key in `idx`
+func (m *MultiIndex[V]) PeekFront(idx OrderedIndex[V]) (v V, ok bool) {
+	return peek(idx.Front())
+}
+
+// PeekBack returns the element with the greatest key in `idx`
+func (m *MultiIndex[V]) PeekBack(idx OrderedIndex[V]) (v V, ok bool) {
+	return peek(idx.Back())
+}
+
+// PopFront removes the element with the smallest key in `idx` from all indexes and returns it.
+// It returns false if `idx` is empty or the element cannot be erased (see TryErase).
+func (m *MultiIndex[V]) PopFront(idx OrderedIndex[V]) (v V, ok bool) {
+	v, ok, err := m.pop(idx.Front())
+	if err != nil {
+		var zero V
+		return zero, false
+	}
+	return v, ok
+}
+
+// PopBack removes the element with the greatest key in `idx` from all indexes and returns it.
+// It returns false if `idx` is empty or the element cannot be erased (see TryErase).
+func (m *MultiIndex[V]) PopBack(idx OrderedIndex[V]) (v V, ok bool) {
+	v, ok, err := m.pop(idx.Back())
+	if err != nil {
+		var zero V
+		return zero, false
+	}
+	return v, ok
+}
+
+// pop erases the element at `it`; ok is false if there is none, and err is set if it cannot be erased
+func (m *MultiIndex[V]) pop(it ConstIterator[V]) (v V, ok bool, err error) {
+	v, ok = peek(it)
+	if !ok {
+		return
+	}
+	if err = m.TryErase(v); err != nil {
+		var zero V
+		return zero, false, err
+	}
+	return v, true, nil
+}
+
+func peek[V comparable](it ConstIterator[V]) (v V, ok bool) {
+	if it == nil || !it.IsValid() {
+		return
+	}
+	return it.Value(), true
+}
@@ -0,0 +1,77 @@
+package multiindex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IndexInfo describes one index of a MultiIndex
+type IndexInfo struct {
+	Name         string
+	Kind         string // "ordered", "hashed", "bitmap", "interval", "rtree", ...
+	Ordered      bool
+	Unique       bool
+	Partial      bool
+	KeyType      string
+	Size         int
+	DistinctKeys int // -1 if the index cannot tell
+}
+
+// Describer is implemented by containers reporting their IndexInfo.
+// Name, Size and Partial are filled in by Schema.
+type Describer interface {
+	Describe() IndexInfo
+}
+
+// Schema lists the indexes of a MultiIndex in order
+type Schema []IndexInfo
+
+func (m MultiIndex[V]) Schema() Schema {
+	s := make(Schema, 0, len(m.MultiIndexBy))
+	for i, cont := range m.MultiIndexBy {
+		info := IndexInfo{Kind: fmt.Sprintf("%T", cont), DistinctKeys: -1}
+		if d, ok := cont.(Describer); ok {
+			info = d.Describe()
+		}
+		_, info.Partial = cont.(Partial[V])
+		info.Name = m.IndexName(i)
+		info.Size = cont.Size()
+		s = append(s, info)
+	}
+	return s
+}
+
+// Signature identifies the structure of the indexes, ignoring their contents.
+// Instances built the same way have equal signatures.
+func (s Schema) Signature() string {
+	var sb strings.Builder
+	for _, info := range s {
+		fmt.Fprintf(&sb, "%s:%s:%s", info.Name, info.Kind, info.KeyType)
+		if info.Ordered {
+			sb.WriteString(":ordered")
+		}
+		if info.Unique {
+			sb.WriteString(":unique")
+		}
+		if info.Partial {
+			sb.WriteString(":partial")
+		}
+		sb.WriteString(";")
+	}
+	return sb.String()
+}
+
+func (s Schema) String() string {
+	var sb strings.Builder
+	for _, info := range s {
+		fmt.Fprintf(&sb, "%s\t%s\tkey=%s", info.Name, info.Kind, info.KeyType)
+		if info.Unique {
+			sb.WriteString(" unique")
+		}
+		if info.Partial {
+			sb.WriteString(" partial")
+		}
+		fmt.Fprintf(&sb, "\tsize=%d distinct=%d\n", info.Size, info.DistinctKeys)
+	}
+	return sb.String()
+}
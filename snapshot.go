@@ -0,0 +1,223 @@
+package multiindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Snapshot format (integers are big-endian):
+//
+//	"MIDX" | version uint32 | count uint64 | count * (uvarint length | encoded element) | CRC-32 (IEEE) of all the preceding bytes
+const (
+	snapshotMagic   = "MIDX"
+	snapshotVersion = 1
+)
+
+// ErrCorruptSnapshot is reported when a snapshot is truncated or fails its checksum
+var ErrCorruptSnapshot = errors.New("multiindex: corrupt snapshot")
+
+// BulkLoader is implemented by containers which are faster to fill at once, such as ordered ones.
+// BulkLoad fills an empty container; it returns false, loading nothing, if an element is rejected.
+type BulkLoader[V comparable] interface {
+	BulkLoad(vs []V) bool
+}
+
+// WriteSnapshot writes all elements to `w`, see LoadSnapshot
+func (m MultiIndex[V]) WriteSnapshot(w io.Writer, codec Codec[V]) error {
+	if len(m.MultiIndexBy) == 0 {
+		return errors.New("multiindex: WriteSnapshot of a multiindex without indexes")
+	}
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(w)
+	out := io.MultiWriter(bw, crc)
+
+	header := binary.BigEndian.AppendUint32([]byte(snapshotMagic), snapshotVersion)
+	header = binary.BigEndian.AppendUint64(header, uint64(m.Size()))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	var err error
+	m.MultiIndexBy[m.primary()].TraversalValue(func(v V) bool {
+		var data []byte
+		if data, err = codec.Encode(v); err != nil {
+			return false
+		}
+		record := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(data)), uint64(len(data)))
+		_, err = out.Write(append(record, data...))
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := bw.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32())); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// checksumReader feeds the bytes read into a hash
+type checksumReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+}
+
+func (c checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	return n, err
+}
+
+func (c checksumReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+// LoadSnapshot fills an empty MultiIndex from a snapshot made by WriteSnapshot.
+// Nothing is loaded if the snapshot is corrupt, an index rejects an element, a constraint is violated
+// or the elements beyond the capacity cannot be evicted (ErrNoRoom).
+// Observers are notified of every loaded element as an insertion.
+func (m *MultiIndex[V]) LoadSnapshot(r io.Reader, codec Codec[V]) error {
+	return m.loadSnapshot(r, codec, true)
+}
+
+// loadSnapshot is LoadSnapshot, checking the constraints only if `checked` is set
+func (m *MultiIndex[V]) loadSnapshot(r io.Reader, codec Codec[V], checked bool) error {
+	if len(m.MultiIndexBy) == 0 {
+		return errors.New("multiindex: LoadSnapshot into a multiindex without indexes")
+	}
+	if m.Size() != 0 {
+		return errors.New("multiindex: LoadSnapshot into a non-empty multiindex")
+	}
+	vs, err := readSnapshot(r, codec)
+	if err != nil {
+		return err
+	}
+
+	for i, cont := range m.MultiIndexBy {
+		if b, ok := cont.(BulkLoader[V]); ok {
+			if !b.BulkLoad(vs) {
+				m.unload(i, vs, nil)
+				return &IndexError{Index: m.IndexName(i), Err: ErrRejected}
+			}
+			continue
+		}
+		for j, v := range vs {
+			if it := cont.Insert(v); it == nil || !it.IsValid() {
+				m.unload(i, vs, vs[:j])
+				return &IndexError{Index: m.IndexName(i), Err: ErrRejected}
+			}
+		}
+	}
+
+	for _, v := range vs {
+		if !checked {
+			break
+		}
+		err := m.checkConstraints(v, false)
+		if err == nil {
+			err = m.checkConstraints(v, true)
+		}
+		if err != nil {
+			m.unload(len(m.MultiIndexBy)-1, vs, vs)
+			return err
+		}
+	}
+	if m.policy != nil {
+		for _, v := range vs {
+			m.policy.Inserted(v)
+		}
+	}
+	victims, err := m.victims(m.Size()-m.capacity, nil)
+	if err != nil {
+		for _, v := range vs {
+			m.policy.Erased(v)
+		}
+		m.unload(len(m.MultiIndexBy)-1, vs, vs)
+		return err
+	}
+	for _, v := range vs {
+		m.notify(Change[V]{Op: OpInsert, New: v})
+	}
+	m.evict(victims)
+	return nil
+}
+
+// unload erases `vs` from the first `n` indexes and `partial` from the n-th one
+func (m *MultiIndex[V]) unload(n int, vs, partial []V) {
+	for i, cont := range m.MultiIndexBy[:n+1] {
+		if i == n {
+			vs = partial
+		}
+		for _, v := range vs {
+			if it := cont.FindValue(v); it != nil && it.IsValid() {
+				cont.Erase_Internal(it)
+			}
+		}
+	}
+}
+
+func readSnapshot[V comparable](r io.Reader, codec Codec[V]) ([]V, error) {
+	cr := checksumReader{bufio.NewReader(r), crc32.NewIEEE()}
+	corrupt := func(err error) error {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrCorruptSnapshot
+		}
+		return err
+	}
+
+	header := make([]byte, len(snapshotMagic)+4+8)
+	if _, err := io.ReadFull(cr, header); err != nil {
+		return nil, corrupt(err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: not a snapshot", ErrCorruptSnapshot)
+	}
+	if version := binary.BigEndian.Uint32(header[len(snapshotMagic):]); version != snapshotVersion {
+		return nil, fmt.Errorf("multiindex: unsupported snapshot version %d", version)
+	}
+	count := binary.BigEndian.Uint64(header[len(snapshotMagic)+4:])
+
+	var records [][]byte
+	for i := uint64(0); i < count; i++ {
+		n, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return nil, corrupt(err)
+		}
+		// a corrupt length must not allocate more than what is actually read
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, cr, int64(n)); err != nil {
+			return nil, corrupt(err)
+		}
+		records = append(records, data.Bytes())
+	}
+
+	sum := cr.h.Sum32()
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(cr.r, trailer); err != nil {
+		return nil, corrupt(err)
+	}
+	if binary.BigEndian.Uint32(trailer) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+
+	vs := make([]V, len(records))
+	for i, data := range records {
+		v, err := codec.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("multiindex: snapshot element %d: %w", i, err)
+		}
+		vs[i] = v
+	}
+	return vs, nil
+}
@@ -0,0 +1,168 @@
+package multiindex
+
+import (
+	"context"
+	"sync"
+)
+
+// Sync makes a MultiIndex safe for concurrent use.
+// Indexes of the wrapped MultiIndex must only be accessed through Do.
+type Sync[V comparable] struct {
+	mu      sync.Mutex
+	m       *MultiIndex[V]
+	changed chan struct{} // closed and replaced whenever elements may have been added
+}
+
+func NewSync[V comparable](m *MultiIndex[V]) *Sync[V] {
+	return &Sync[V]{
+		m:       m,
+		changed: make(chan struct{}),
+	}
+}
+
+// Locker returns the mutex guarding the MultiIndex, e.g. for StartJanitor
+func (s *Sync[V]) Locker() sync.Locker {
+	return &s.mu
+}
+
+// Do runs `f` with exclusive access to the MultiIndex
+func (s *Sync[V]) Do(f func(m *MultiIndex[V])) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.m)
+	s.notify()
+}
+
+func (s *Sync[V]) Insert(v V) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok := s.m.Insert(v)
+	if ok {
+		s.notify()
+	}
+	return ok
+}
+
+func (s *Sync[V]) Erase(v V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m.Erase(v)
+}
+
+func (s *Sync[V]) Modify(old, new V) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok := s.m.Modify(old, new)
+	if ok {
+		s.notify()
+	}
+	return ok
+}
+
+func (s *Sync[V]) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m.Size()
+}
+
+func (s *Sync[V]) Verify() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m.Verify()
+}
+
+func (s *Sync[V]) PeekFront(idx OrderedIndex[V]) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m.PeekFront(idx)
+}
+
+func (s *Sync[V]) PeekBack(idx OrderedIndex[V]) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m.PeekBack(idx)
+}
+
+func (s *Sync[V]) PopFront(idx OrderedIndex[V]) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m.PopFront(idx)
+}
+
+func (s *Sync[V]) PopBack(idx OrderedIndex[V]) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m.PopBack(idx)
+}
+
+// PopWait is PopFront which blocks until `idx` is non-empty or `ctx` is done.
+// If the front element cannot be erased, e.g. because of a restricting foreign key,
+// it returns the error of TryErase instead of waiting.
+func (s *Sync[V]) PopWait(ctx context.Context, idx OrderedIndex[V]) (V, error) {
+	for {
+		s.mu.Lock()
+		v, ok, err := s.m.pop(idx.Front())
+		changed := s.changed
+		s.mu.Unlock()
+		if err != nil {
+			return v, err
+		}
+		if ok {
+			return v, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// notify wakes up PopWait callers; s.mu must be held
+func (s *Sync[V]) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Sync[V]) CompareAndSwap(old, new V) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok, err := s.m.CompareAndSwap(old, new)
+	if ok {
+		s.notify()
+	}
+	return ok, err
+}
+
+func (s *Sync[V]) ModifyVersion(old V, version uint64, new V) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.m.ModifyVersion(old, version, new)
+	if err == nil {
+		s.notify()
+	}
+	return err
+}
+
+// Lookup returns the element found by `find`, e.g. with Find on a unique index, and its version,
+// to update it with ModifyVersion:
+//
+//	for {
+//		v, version, ok := s.Lookup(func(m *MultiIndex[V]) ConstIterator[V] { return byID.Find(id) })
+//		...
+//		if err := s.ModifyVersion(v, version, updated); !errors.Is(err, ErrConflict) {
+//			return err
+//		}
+//	}
+func (s *Sync[V]) Lookup(find func(m *MultiIndex[V]) ConstIterator[V]) (v V, version uint64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := find(s.m)
+	if it == nil || !it.IsValid() {
+		return v, 0, false
+	}
+	v = it.Value()
+	return v, s.m.Version(v), true
+}
@@ -0,0 +1,68 @@
+package multiindex
+
+import "errors"
+
+// ErrConflict is reported by ModifyVersion when the element changed since it was read
+var ErrConflict = errors.New("multiindex: element changed concurrently")
+
+// EnableVersions starts counting versions of elements, see Version.
+// Elements already present get a version too.
+func (m *MultiIndex[V]) EnableVersions() {
+	if m.versions != nil {
+		return
+	}
+	m.versions = map[V]uint64{}
+	if len(m.MultiIndexBy) == 0 {
+		return
+	}
+	m.MultiIndexBy[m.primary()].TraversalValue(func(v V) bool {
+		m.trackVersion(Change[V]{Op: OpInsert, New: v})
+		return true
+	})
+}
+
+// trackVersion gives a new version to the element inserted or modified by `c`.
+// Versions are never reused, so an element modified back to a previous value gets a new one.
+func (m *MultiIndex[V]) trackVersion(c Change[V]) {
+	if c.Op != OpInsert {
+		delete(m.versions, c.Old)
+	}
+	if c.Op != OpErase {
+		m.lastVersion++
+		m.versions[c.New] = m.lastVersion
+	}
+}
+
+// Version returns the version of `v`, 0 if `v` is absent or versions are not enabled
+func (m *MultiIndex[V]) Version(v V) uint64 {
+	return m.versions[v]
+}
+
+// CompareAndSwap replaces `old` with `new` if `old` is present.
+// It reports false with no error if `old` is absent, and the *IndexError if `new` is rejected.
+func (m *MultiIndex[V]) CompareAndSwap(old, new V) (bool, error) {
+	switch err := m.modify(old, new); {
+	case errors.Is(err, ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	m.notify(Change[V]{Op: OpModify, Old: old, New: new})
+	return true, nil
+}
+
+// ModifyVersion replaces `old` with `new` if `old` is still at `version` (see Version),
+// otherwise it fails with ErrConflict. Versions must be enabled.
+func (m *MultiIndex[V]) ModifyVersion(old V, version uint64, new V) error {
+	if m.versions == nil {
+		return errors.New("multiindex: versions are not enabled")
+	}
+	if version == 0 || m.versions[old] != version {
+		return ErrConflict
+	}
+	ok, err := m.CompareAndSwap(old, new)
+	if err == nil && !ok {
+		return ErrConflict
+	}
+	return err
+}